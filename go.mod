@@ -12,6 +12,7 @@ require (
 	github.com/docker/docker v27.2.0+incompatible
 	github.com/hashicorp/go-hclog v1.6.3
 	github.com/hashicorp/go-plugin v1.6.0
+	github.com/kevinburke/ssh_config v1.2.0
 	github.com/sirupsen/logrus v1.9.3
 	golang.org/x/crypto v0.31.0
 	golang.org/x/sync v0.10.0
@@ -89,7 +90,6 @@ require (
 	github.com/hashicorp/yamux v0.1.1 // indirect
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/jbenet/go-context v0.0.0-20150711004518-d14ea06fba99 // indirect
-	github.com/kevinburke/ssh_config v1.2.0 // indirect
 	github.com/ktrysmt/go-bitbucket v0.9.76 // indirect
 	github.com/lucasb-eyer/go-colorful v1.2.0 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
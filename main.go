@@ -2,12 +2,15 @@ package main
 
 import (
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/daytonaio/daytona/pkg/provider"
 	"github.com/daytonaio/daytona/pkg/runner/providermanager"
 	"github.com/hashicorp/go-hclog"
 	hc_plugin "github.com/hashicorp/go-plugin"
 
+	"github.com/daytonaio/daytona-provider-docker/pkg/client"
 	p "github.com/daytonaio/daytona-provider-docker/pkg/provider"
 )
 
@@ -17,6 +20,17 @@ func main() {
 		Output:     os.Stderr,
 		JSONFormat: true,
 	})
+
+	// Tear down the tunnels and SSH connections when the plugin is stopped
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGTERM)
+	go func() {
+		<-sigChan
+		client.Shutdown()
+		os.Exit(0)
+	}()
+	defer client.Shutdown()
+
 	hc_plugin.Serve(&hc_plugin.ServeConfig{
 		HandshakeConfig: providermanager.ProviderHandshakeConfig,
 		Plugins: map[string]hc_plugin.Plugin{
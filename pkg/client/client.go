@@ -1,22 +1,29 @@
 package client
 
 import (
-	"context"
 	"fmt"
 	"os"
-	"path"
+	"path/filepath"
 	"runtime"
 	"strings"
 
-	"github.com/daytonaio/daytona-provider-docker/pkg/ssh_tunnel/util"
 	"github.com/daytonaio/daytona-provider-docker/pkg/types"
 
 	"github.com/docker/docker/client"
-
-	log "github.com/sirupsen/logrus"
 )
 
+const defaultRemoteSockPath = "/var/run/docker.sock"
+
 func GetClient(targetOptions types.TargetConfigOptions, sockDir string) (*client.Client, error) {
+	err := targetOptions.ResolveDockerContext()
+	if err != nil {
+		return nil, err
+	}
+
+	if targetOptions.IsTcp() {
+		return getTcpClient(targetOptions)
+	}
+
 	if targetOptions.RemoteHostname == nil {
 		return getLocalClient(targetOptions)
 	}
@@ -30,8 +37,16 @@ func getLocalClient(targetOptions types.TargetConfigOptions) (*client.Client, er
 		schema = "npipe://"
 	}
 
-	if targetOptions.SockPath != nil && *targetOptions.SockPath != "" && *targetOptions.SockPath != "/var/run/docker.sock" {
-		cli, err := client.NewClientWithOpts(client.WithHost(fmt.Sprintf("%s%s", schema, *targetOptions.SockPath)), client.WithAPIVersionNegotiation())
+	sockPath, err := SockPath(targetOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	// Targets created with the former Sock Path default are configured from the environment, like before
+	isFormerDefault := targetOptions.SockPath != nil && *targetOptions.SockPath == "/var/run/docker.sock"
+
+	if sockPath != "" && !isFormerDefault {
+		cli, err := client.NewClientWithOpts(client.WithHost(fmt.Sprintf("%s%s", schema, sockPath)), client.WithAPIVersionNegotiation())
 		if err != nil {
 			return nil, err
 		}
@@ -48,7 +63,24 @@ func getLocalClient(targetOptions types.TargetConfigOptions) (*client.Client, er
 }
 
 func getRemoteClient(targetOptions types.TargetConfigOptions, sockDir string) (*client.Client, error) {
-	localSockPath, err := forwardDockerSock(targetOptions, sockDir)
+	sockPath, err := SockPath(targetOptions)
+	if err != nil {
+		return nil, err
+	}
+	if sockPath != "" {
+		targetOptions.SockPath = &sockPath
+	}
+
+	if targetOptions.RemoteConnectionMode != nil {
+		switch *targetOptions.RemoteConnectionMode {
+		case types.RemoteConnectionModeSshDirect:
+			return getSshDialedClient(targetOptions, dialRemoteSock(remoteSockPath(targetOptions)))
+		case types.RemoteConnectionModeDialStdio:
+			return getSshDialedClient(targetOptions, dialStdio(targetOptions.SockPath))
+		}
+	}
+
+	localSockPath, err := DefaultTunnelManager.ForwardDockerSock(targetOptions, sockDir)
 	if err != nil {
 		return nil, err
 	}
@@ -61,42 +93,50 @@ func getRemoteClient(targetOptions types.TargetConfigOptions, sockDir string) (*
 	return cli, nil
 }
 
-func forwardDockerSock(targetOptions types.TargetConfigOptions, sockDir string) (string, error) {
-	localSockPath := path.Join(sockDir, fmt.Sprintf("daytona-%s-docker.sock", strings.ReplaceAll(*targetOptions.RemoteHostname, ".", "-")))
-
-	if _, err := os.Stat(path.Dir(localSockPath)); err != nil {
-		err := os.MkdirAll(path.Dir(localSockPath), 0755)
-		if err != nil {
-			return "", err
-		}
+// getTcpClient returns a client for the daemon at the Docker Host URL, using mutual TLS if TLS material is set
+func getTcpClient(targetOptions types.TargetConfigOptions) (*client.Client, error) {
+	opts := []client.Opt{
+		client.WithHost(*targetOptions.DockerHost),
+		client.WithAPIVersionNegotiation(),
 	}
 
-	if _, err := os.Stat(localSockPath); err == nil {
-		return localSockPath, nil
+	if targetOptions.UsesTls() {
+		opts = append(opts, client.WithTLSClientConfig(
+			expandHome(targetOptions.TlsCaCert),
+			expandHome(targetOptions.TlsCert),
+			expandHome(targetOptions.TlsKey),
+		))
 	}
 
-	remoteSockPath := "/var/run/docker.sock"
-	if targetOptions.SockPath != nil && *targetOptions.SockPath != "" {
-		remoteSockPath = *targetOptions.SockPath
+	cli, err := client.NewClientWithOpts(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a client for %s: %w", *targetOptions.DockerHost, err)
 	}
 
-	startedChan, errChan := util.ForwardRemoteUnixSock(
-		context.Background(),
-		targetOptions,
-		localSockPath,
-		remoteSockPath,
-	)
+	return cli, nil
+}
 
-	go func() {
-		err := <-errChan
-		if err != nil {
-			log.Error(err)
-			startedChan <- false
-			os.Remove(localSockPath)
+// expandHome returns the path with a leading ~/ replaced by the home directory, or an empty string if it's not set
+func expandHome(path *string) string {
+	if path == nil {
+		return ""
+	}
+
+	if strings.HasPrefix(*path, "~/") {
+		homeDir, err := os.UserHomeDir()
+		if err == nil {
+			return filepath.Join(homeDir, (*path)[2:])
 		}
-	}()
+	}
 
-	<-startedChan
+	return *path
+}
 
-	return localSockPath, nil
+// remoteSockPath returns the docker socket on the remote host of the target, /var/run/docker.sock if it's not
+// discovered yet
+func remoteSockPath(targetOptions types.TargetConfigOptions) string {
+	if targetOptions.SockPath != nil && *targetOptions.SockPath != "" {
+		return *targetOptions.SockPath
+	}
+	return defaultRemoteSockPath
 }
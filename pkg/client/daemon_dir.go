@@ -0,0 +1,106 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+
+	"github.com/daytonaio/daytona-provider-docker/pkg/types"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/client"
+)
+
+// DaemonDirImage is the image of the short-lived containers managing directories on the host of a docker daemon
+// that isn't reached over SSH. It's fully qualified because Podman may not resolve short names.
+const DaemonDirImage = "docker.io/library/busybox:stable"
+
+// CreateDaemonDir creates dir on the host of the docker daemon of a target that isn't reached over SSH, so it can be
+// bind mounted. The runner filesystem isn't touched. The daemon creates the missing sources of `host:container`
+// binds when a container starts, so a short-lived container is started with dir bound.
+func CreateDaemonDir(targetOptions types.TargetConfigOptions, sockDir, dir string) error {
+	err := runDaemonDirContainer(targetOptions, sockDir, dir, []string{"true"})
+	if err != nil {
+		return fmt.Errorf("failed to create %s on the docker host: %w", dir, err)
+	}
+	return nil
+}
+
+// RemoveDaemonDir removes dir and its content from the host of the docker daemon of a target that isn't reached
+// over SSH. The parent of dir is bound in a short-lived container removing dir from it.
+func RemoveDaemonDir(targetOptions types.TargetConfigOptions, sockDir, dir string) error {
+	// Using path instead of filepath because we always want to use / as the separator
+	err := runDaemonDirContainer(targetOptions, sockDir, path.Dir(dir), []string{"rm", "-rf", path.Join("/daytona-dir", path.Base(dir))})
+	if err != nil {
+		return fmt.Errorf("failed to remove %s from the docker host: %w", dir, err)
+	}
+	return nil
+}
+
+// runDaemonDirContainer runs cmd in a container of DaemonDirImage with dir bound to /daytona-dir and removes the
+// container once cmd exits
+func runDaemonDirContainer(targetOptions types.TargetConfigOptions, sockDir, dir string, cmd []string) error {
+	cli, err := GetClient(targetOptions, sockDir)
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	ctx := context.Background()
+
+	err = pullMissingImage(ctx, cli, DaemonDirImage)
+	if err != nil {
+		return err
+	}
+
+	resp, err := cli.ContainerCreate(ctx, &container.Config{
+		Image:      DaemonDirImage,
+		Entrypoint: cmd[:1],
+		Cmd:        cmd[1:],
+	}, &container.HostConfig{
+		Binds: []string{fmt.Sprintf("%s:/daytona-dir", dir)},
+	}, nil, nil, "")
+	if err != nil {
+		return err
+	}
+	defer cli.ContainerRemove(ctx, resp.ID, container.RemoveOptions{Force: true})
+
+	err = cli.ContainerStart(ctx, resp.ID, container.StartOptions{})
+	if err != nil {
+		return err
+	}
+
+	statusChan, errChan := cli.ContainerWait(ctx, resp.ID, container.WaitConditionNotRunning)
+	select {
+	case err := <-errChan:
+		return err
+	case status := <-statusChan:
+		if status.StatusCode != 0 {
+			return fmt.Errorf("%s exited with status %d", cmd[0], status.StatusCode)
+		}
+	}
+
+	return nil
+}
+
+func pullMissingImage(ctx context.Context, cli client.APIClient, imageName string) error {
+	_, _, err := cli.ImageInspectWithRaw(ctx, imageName)
+	if err == nil {
+		return nil
+	}
+	if !client.IsErrNotFound(err) {
+		return err
+	}
+
+	reader, err := cli.ImagePull(ctx, imageName, image.PullOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to pull %s: %w", imageName, err)
+	}
+	defer reader.Close()
+
+	// The pull is done once its progress is read to the end
+	_, err = io.Copy(io.Discard, reader)
+	return err
+}
@@ -0,0 +1,97 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/daytonaio/daytona-provider-docker/pkg/types"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// testDaemon answers the requests of runDaemonDirContainer and records the containers it creates
+type testDaemon struct {
+	mutex      sync.Mutex
+	containers []container.CreateRequest
+	pulled     bool
+	removed    bool
+}
+
+func (d *testDaemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/_ping"):
+		w.Header().Set("Api-Version", "1.41")
+		w.Write([]byte("OK"))
+	case strings.HasSuffix(r.URL.Path, "/json") && strings.Contains(r.URL.Path, "/images/"):
+		if !d.pulled {
+			http.Error(w, `{"message":"no such image"}`, http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{}`))
+	case strings.HasSuffix(r.URL.Path, "/images/create"):
+		d.pulled = true
+		w.Write([]byte(`{"status":"Downloaded newer image"}`))
+	case strings.HasSuffix(r.URL.Path, "/containers/create"):
+		var req container.CreateRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		d.containers = append(d.containers, req)
+		w.Write([]byte(`{"Id":"dir"}`))
+	case strings.HasSuffix(r.URL.Path, "/containers/dir/start"):
+		w.WriteHeader(http.StatusNoContent)
+	case strings.HasSuffix(r.URL.Path, "/containers/dir/wait"):
+		w.Write([]byte(`{"StatusCode":0}`))
+	case r.Method == http.MethodDelete && strings.HasSuffix(r.URL.Path, "/containers/dir"):
+		d.removed = true
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestDaemonDir(t *testing.T) {
+	daemon := &testDaemon{}
+	server := httptest.NewServer(daemon)
+	defer server.Close()
+
+	dockerHost := "tcp://" + server.Listener.Addr().String()
+	targetOptions := types.TargetConfigOptions{DockerHost: &dockerHost}
+
+	err := CreateDaemonDir(targetOptions, t.TempDir(), "/data/target/workspace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = RemoveDaemonDir(targetOptions, t.TempDir(), "/data/target/workspace")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !daemon.pulled {
+		t.Errorf("Expected the missing %s image to be pulled", DaemonDirImage)
+	}
+	if !daemon.removed {
+		t.Errorf("Expected the container to be removed")
+	}
+	if len(daemon.containers) != 2 {
+		t.Fatalf("Expected two containers, got %d", len(daemon.containers))
+	}
+
+	create, remove := daemon.containers[0], daemon.containers[1]
+	if len(create.HostConfig.Binds) != 1 || create.HostConfig.Binds[0] != "/data/target/workspace:/daytona-dir" {
+		t.Errorf("Expected the directory to be bound, got %v", create.HostConfig.Binds)
+	}
+	if len(remove.HostConfig.Binds) != 1 || remove.HostConfig.Binds[0] != "/data/target:/daytona-dir" {
+		t.Errorf("Expected the parent directory to be bound, got %v", remove.HostConfig.Binds)
+	}
+	command := strings.Join(append(remove.Entrypoint, remove.Cmd...), " ")
+	if command != "rm -rf /daytona-dir/workspace" {
+		t.Errorf("Expected the directory to be removed from its parent, got %q", command)
+	}
+}
@@ -0,0 +1,166 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// dialStdio returns a dial function that runs `docker system dial-stdio` in a SSH session and uses its stdio as the
+// connection, like the docker CLI does for `ssh://` hosts. If sockPath is set, the docker CLI connects to it.
+func dialStdio(sockPath *string) func(sshClient *ssh.Client) (net.Conn, error) {
+	command := "docker system dial-stdio"
+	path := ""
+	if sockPath != nil && *sockPath != "" {
+		command = fmt.Sprintf("docker --host unix://%s system dial-stdio", shellQuote(*sockPath))
+		path = *sockPath
+	}
+
+	return func(sshClient *ssh.Client) (net.Conn, error) {
+		session, err := sshClient.NewSession()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open a session on %s: %w", sshClient.RemoteAddr(), err)
+		}
+
+		stdin, err := session.StdinPipe()
+		if err != nil {
+			session.Close()
+			return nil, err
+		}
+
+		stdout, err := session.StdoutPipe()
+		if err != nil {
+			session.Close()
+			return nil, err
+		}
+
+		conn := &stdioConn{
+			session:    session,
+			stdin:      stdin,
+			stdout:     stdout,
+			sockPath:   path,
+			localAddr:  sshClient.LocalAddr(),
+			remoteAddr: sshClient.RemoteAddr(),
+		}
+		session.Stderr = &conn.stderr
+
+		err = session.Start(command)
+		if err != nil {
+			session.Close()
+			return nil, fmt.Errorf("failed to run %q on %s: %w", command, sshClient.RemoteAddr(), err)
+		}
+
+		return conn, nil
+	}
+}
+
+// stdioConn is a connection to the docker API over the stdio of a `docker system dial-stdio` session
+type stdioConn struct {
+	session    *ssh.Session
+	stdin      io.WriteCloser
+	stdout     io.Reader
+	stderr     lockedBuffer
+	sockPath   string
+	localAddr  net.Addr
+	remoteAddr net.Addr
+	closeOnce  sync.Once
+}
+
+func (c *stdioConn) Read(p []byte) (int, error) {
+	n, err := c.stdout.Read(p)
+	if errors.Is(err, io.EOF) {
+		// The command exited, its output explains why (e.g. docker not installed or permission denied)
+		if stderr := strings.TrimSpace(c.stderr.String()); stderr != "" {
+			err := fmt.Errorf("docker system dial-stdio on %s failed: %s", c.remoteAddr, stderr)
+			if kind := dialStdioErrorKind(stderr); kind != nil {
+				return n, &SockError{Host: c.remoteAddr.String(), Path: c.sockPath, Kind: kind, Err: err}
+			}
+			return n, err
+		}
+	}
+	return n, err
+}
+
+func (c *stdioConn) Write(p []byte) (int, error) {
+	return c.stdin.Write(p)
+}
+
+// CloseWrite closes stdin, the docker client uses it to half-close hijacked connections
+func (c *stdioConn) CloseWrite() error {
+	return c.stdin.Close()
+}
+
+func (c *stdioConn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		c.stdin.Close()
+		err = c.session.Close()
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+	})
+	return err
+}
+
+func (c *stdioConn) LocalAddr() net.Addr {
+	return c.localAddr
+}
+
+func (c *stdioConn) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
+
+// Deadlines are not supported by SSH sessions, the docker client relies on contexts instead
+func (c *stdioConn) SetDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *stdioConn) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *stdioConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+// lockedBuffer is written by the session while the connection reads it
+type lockedBuffer struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.String()
+}
+
+// dialStdioErrorKind recognizes the errors the docker CLI prints when it can't connect to the daemon
+func dialStdioErrorKind(stderr string) error {
+	switch {
+	case strings.Contains(stderr, "permission denied"):
+		return ErrSockPermissionDenied
+	case strings.Contains(stderr, "no such file or directory"):
+		return ErrSockNotFound
+	case strings.Contains(stderr, "Is the docker daemon running?"):
+		return ErrDaemonNotResponding
+	}
+	return nil
+}
+
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
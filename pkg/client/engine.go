@@ -0,0 +1,126 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/daytonaio/daytona-provider-docker/pkg/types"
+
+	"github.com/docker/docker/client"
+	log "github.com/sirupsen/logrus"
+)
+
+// Engine is the container engine serving the docker API of a target
+type Engine string
+
+const (
+	EngineDocker Engine = "docker"
+	EnginePodman Engine = "podman"
+)
+
+// PodmanRootfulSockPath is the API socket of the podman.socket system service
+const PodmanRootfulSockPath = "/run/podman/podman.sock"
+
+const engineDetectTimeout = 10 * time.Second
+
+// detectedEngines caches the engines of the targets by the address of their daemon, detecting one takes a client
+var detectedEngines = map[string]Engine{}
+var detectedEnginesMutex sync.Mutex
+
+// DetectEngine asks the daemon for its version. Podman lists a "Podman Engine" component in it.
+func DetectEngine(cli client.APIClient) (Engine, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), engineDetectTimeout)
+	defer cancel()
+
+	version, err := cli.ServerVersion(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get the version of the container engine: %w", err)
+	}
+
+	for _, component := range version.Components {
+		if strings.Contains(strings.ToLower(component.Name), "podman") {
+			return EnginePodman, nil
+		}
+	}
+
+	if strings.Contains(strings.ToLower(version.Platform.Name), "podman") {
+		return EnginePodman, nil
+	}
+
+	return EngineDocker, nil
+}
+
+// HostGatewayName returns the hostname containers of the engine use to reach their host
+func (e Engine) HostGatewayName() string {
+	if e == EnginePodman {
+		return "host.containers.internal"
+	}
+	return "host.docker.internal"
+}
+
+// PodmanRootlessSockPath returns the API socket of the podman.socket user service of the current user
+func PodmanRootlessSockPath() string {
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		runtimeDir = fmt.Sprintf("/run/user/%d", os.Getuid())
+	}
+	return filepath.Join(runtimeDir, "podman", "podman.sock")
+}
+
+// TargetEngine returns the engine serving the docker API of the target. It's detected with a new client the first
+// time and defaults to Docker if the detection fails, the failed detection is retried the next time.
+func TargetEngine(targetOptions types.TargetConfigOptions, sockDir string) Engine {
+	err := targetOptions.ResolveDockerContext()
+	if err != nil {
+		log.Warnf("failed to detect the container engine: %v", err)
+		return EngineDocker
+	}
+
+	key := engineKey(targetOptions)
+
+	detectedEnginesMutex.Lock()
+	engine, ok := detectedEngines[key]
+	detectedEnginesMutex.Unlock()
+	if ok {
+		return engine
+	}
+
+	cli, err := GetClient(targetOptions, sockDir)
+	if err != nil {
+		log.Warnf("failed to detect the container engine: %v", err)
+		return EngineDocker
+	}
+	defer cli.Close()
+
+	engine, err = DetectEngine(cli)
+	if err != nil {
+		log.Warnf("failed to detect the container engine: %v", err)
+		return EngineDocker
+	}
+
+	detectedEnginesMutex.Lock()
+	detectedEngines[key] = engine
+	detectedEnginesMutex.Unlock()
+
+	return engine
+}
+
+// engineKey returns the address of the daemon of the target
+func engineKey(targetOptions types.TargetConfigOptions) string {
+	if targetOptions.IsTcp() {
+		return *targetOptions.DockerHost
+	}
+	if targetOptions.RemoteHostname != nil {
+		return tunnelKey(targetOptions)
+	}
+	if targetOptions.SockPath != nil && *targetOptions.SockPath != "" {
+		return *targetOptions.SockPath
+	}
+	// The local daemon is discovered or configured from the environment
+	return ""
+}
@@ -0,0 +1,97 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/daytonaio/daytona-provider-docker/pkg/types"
+
+	"github.com/docker/docker/client"
+)
+
+func TestDetectEngine(t *testing.T) {
+	tests := []struct {
+		version  string
+		expected Engine
+	}{
+		{
+			version:  `{"Platform":{"Name":"Docker Engine - Community"},"Components":[{"Name":"Engine","Version":"27.3.1"}],"ApiVersion":"1.47"}`,
+			expected: EngineDocker,
+		},
+		{
+			version:  `{"Platform":{"Name":"linux/amd64/fedora-40"},"Components":[{"Name":"Podman Engine","Version":"5.2.3"}],"ApiVersion":"1.41"}`,
+			expected: EnginePodman,
+		},
+	}
+
+	for _, test := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !strings.HasSuffix(r.URL.Path, "/version") {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(test.version))
+		}))
+
+		cli, err := client.NewClientWithOpts(client.WithHost("tcp://"+server.Listener.Addr().String()), client.WithVersion("1.41"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		engine, err := DetectEngine(cli)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if engine != test.expected {
+			t.Errorf("Expected engine %s, got %s", test.expected, engine)
+		}
+
+		cli.Close()
+		server.Close()
+	}
+}
+
+func TestTargetEngine(t *testing.T) {
+	var versionRequests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/_ping"):
+			w.Header().Set("Api-Version", "1.41")
+			w.Write([]byte("OK"))
+		case strings.HasSuffix(r.URL.Path, "/version"):
+			versionRequests++
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"Components":[{"Name":"Podman Engine","Version":"5.2.3"}],"ApiVersion":"1.41"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	dockerHost := "tcp://" + server.Listener.Addr().String()
+	targetOptions := types.TargetConfigOptions{DockerHost: &dockerHost}
+
+	for i := 0; i < 3; i++ {
+		engine := TargetEngine(targetOptions, t.TempDir())
+		if engine != EnginePodman {
+			t.Fatalf("Expected engine %s, got %s", EnginePodman, engine)
+		}
+	}
+	if versionRequests != 1 {
+		t.Errorf("Expected the engine to be detected once, got %d detections", versionRequests)
+	}
+
+	// A daemon that doesn't answer isn't cached
+	unreachable := "tcp://127.0.0.1:1"
+	engine := TargetEngine(types.TargetConfigOptions{DockerHost: &unreachable}, t.TempDir())
+	if engine != EngineDocker {
+		t.Errorf("Expected engine %s for an unreachable daemon, got %s", EngineDocker, engine)
+	}
+	if _, ok := detectedEngines[unreachable]; ok {
+		t.Errorf("Expected the failed detection not to be cached")
+	}
+}
@@ -0,0 +1,145 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"strings"
+
+	"github.com/docker/docker/client"
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	// ErrSockNotFound is matched by the errors of docker sockets that don't exist
+	ErrSockNotFound = errors.New("docker socket not found")
+	// ErrSockPermissionDenied is matched by the errors of docker sockets the user isn't allowed to connect to
+	ErrSockPermissionDenied = errors.New("permission denied on the docker socket")
+	// ErrDaemonNotResponding is matched by the errors of docker sockets no daemon answers on
+	ErrDaemonNotResponding = errors.New("docker daemon not responding")
+)
+
+// SockError is returned when the docker socket of a target can't be used. It matches its Kind with errors.Is.
+type SockError struct {
+	// Host is the remote host of the socket, empty for local sockets
+	Host string
+	Path string
+	// Kind is ErrSockNotFound, ErrSockPermissionDenied or ErrDaemonNotResponding
+	Kind error
+	Err  error
+}
+
+func (e *SockError) Error() string {
+	where := e.Path
+	if e.Host != "" && where != "" {
+		where = fmt.Sprintf("%s on %s", e.Path, e.Host)
+	} else if e.Host != "" {
+		where = e.Host
+	}
+
+	message := e.Kind.Error()
+	if where != "" {
+		message = fmt.Sprintf("%s: %s", message, where)
+	}
+	if e.Err != nil {
+		message = fmt.Sprintf("%s: %v", message, e.Err)
+	}
+	return message
+}
+
+func (e *SockError) Unwrap() error {
+	return e.Err
+}
+
+func (e *SockError) Is(target error) bool {
+	return target == e.Kind
+}
+
+// Engine returns the container engine the socket belongs to, guessed from its path because a socket that can't
+// be used can't be asked
+func (e *SockError) Engine() Engine {
+	if strings.Contains(e.Path, "podman") {
+		return EnginePodman
+	}
+	return EngineDocker
+}
+
+// ClassifyError returns the sentinel matching a docker socket error, nil if it's not one. The errors of the docker
+// client are often flattened into strings by the callers, so their messages are checked too.
+func ClassifyError(err error) error {
+	for _, kind := range []error{ErrSockPermissionDenied, ErrSockNotFound, ErrDaemonNotResponding} {
+		if errors.Is(err, kind) {
+			return kind
+		}
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" && opErr.Net == "unix" {
+		switch {
+		case errors.Is(err, fs.ErrPermission):
+			return ErrSockPermissionDenied
+		case errors.Is(err, fs.ErrNotExist):
+			return ErrSockNotFound
+		default:
+			return ErrDaemonNotResponding
+		}
+	}
+
+	message := err.Error()
+	switch {
+	case strings.Contains(message, "permission denied while trying to connect to the Docker daemon"):
+		return ErrSockPermissionDenied
+	case client.IsErrConnectionFailed(err), strings.Contains(message, "Cannot connect to the Docker daemon"):
+		return ErrDaemonNotResponding
+	}
+
+	return nil
+}
+
+// remoteSockCheck prints why a socket on the remote host can't be used
+const remoteSockCheck = `if [ ! -e %[1]s ]; then echo missing; elif [ ! -r %[1]s ] || [ ! -w %[1]s ]; then echo denied; else echo ok; fi`
+
+// checkRemoteSock returns a SockError explaining why the docker daemon doesn't answer on the remote socket
+func checkRemoteSock(sshClient *ssh.Client, sockPath string, cause error) error {
+	sockErr := &SockError{
+		Host: sshClient.RemoteAddr().String(),
+		Path: sockPath,
+		Kind: ErrDaemonNotResponding,
+		Err:  cause,
+	}
+
+	session, err := sshClient.NewSession()
+	if err != nil {
+		return sockErr
+	}
+	defer session.Close()
+
+	output, err := session.Output(fmt.Sprintf(remoteSockCheck, shellQuote(sockPath)))
+	if err != nil {
+		return sockErr
+	}
+
+	switch strings.TrimSpace(string(output)) {
+	case "missing":
+		sockErr.Kind = ErrSockNotFound
+	case "denied":
+		sockErr.Kind = ErrSockPermissionDenied
+	}
+
+	return sockErr
+}
+
+// sockDiscoveryError returns the most useful failure of the discovery: a socket the user can't access, then a
+// socket no daemon answers on, then no socket at all
+func sockDiscoveryError(host string, failures []*SockError, err error) error {
+	for _, kind := range []error{ErrSockPermissionDenied, ErrDaemonNotResponding} {
+		for _, failure := range failures {
+			if failure.Kind == kind {
+				return &SockError{Host: host, Path: failure.Path, Kind: kind, Err: err}
+			}
+		}
+	}
+
+	return &SockError{Host: host, Kind: ErrSockNotFound, Err: err}
+}
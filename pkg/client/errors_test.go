@@ -0,0 +1,72 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestClassifyError(t *testing.T) {
+	dialErr := func(errno syscall.Errno) error {
+		return fmt.Errorf("error during connect: %w", &net.OpError{Op: "dial", Net: "unix", Err: os.NewSyscallError("connect", errno)})
+	}
+
+	tests := []struct {
+		name     string
+		err      error
+		expected error
+	}{
+		{name: "permission denied", err: dialErr(syscall.EACCES), expected: ErrSockPermissionDenied},
+		{name: "missing socket", err: dialErr(syscall.ENOENT), expected: ErrSockNotFound},
+		{name: "connection refused", err: dialErr(syscall.ECONNREFUSED), expected: ErrDaemonNotResponding},
+		{
+			name:     "flattened permission denied",
+			err:      errors.New("permission denied while trying to connect to the Docker daemon socket at unix:///var/run/docker.sock"),
+			expected: ErrSockPermissionDenied,
+		},
+		{
+			name:     "flattened connection failure",
+			err:      errors.New("Cannot connect to the Docker daemon at unix:///var/run/docker.sock. Is the docker daemon running?"),
+			expected: ErrDaemonNotResponding,
+		},
+		{
+			name:     "socket error",
+			err:      fmt.Errorf("failed to forward: %w", &SockError{Host: "docker.example.com", Path: "/var/run/docker.sock", Kind: ErrSockPermissionDenied}),
+			expected: ErrSockPermissionDenied,
+		},
+		{name: "other", err: errors.New("No such image: alpine")},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			kind := ClassifyError(test.err)
+			if kind != test.expected {
+				t.Errorf("Expected %v, got %v", test.expected, kind)
+			}
+		})
+	}
+}
+
+func TestSockDiscoveryError(t *testing.T) {
+	cause := errors.New("no docker socket answered")
+
+	err := sockDiscoveryError("docker.example.com", []*SockError{
+		{Path: "/run/user/1000/docker.sock", Kind: ErrDaemonNotResponding},
+		{Path: "/var/run/docker.sock", Kind: ErrSockPermissionDenied},
+	}, cause)
+	if !errors.Is(err, ErrSockPermissionDenied) {
+		t.Errorf("Expected a permission denied error, got %v", err)
+	}
+	expected := "permission denied on the docker socket: /var/run/docker.sock on docker.example.com: no docker socket answered"
+	if err.Error() != expected {
+		t.Errorf("Expected %q, got %q", expected, err.Error())
+	}
+
+	err = sockDiscoveryError("", nil, cause)
+	if !errors.Is(err, ErrSockNotFound) || !errors.Is(err, cause) {
+		t.Errorf("Expected a socket not found error wrapping the cause, got %v", err)
+	}
+}
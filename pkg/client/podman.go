@@ -0,0 +1,44 @@
+package client
+
+import (
+	"context"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// podmanClient adapts the containers the Daytona docker client creates to Podman
+type podmanClient struct {
+	client.APIClient
+}
+
+// WithEngine returns cli adapted to the engine serving its API
+func WithEngine(cli client.APIClient, engine Engine) client.APIClient {
+	if engine == EnginePodman {
+		return &podmanClient{APIClient: cli}
+	}
+	return cli
+}
+
+// ContainerCreate drops the host-gateway extra hosts, which Podman before 5.3 rejects. Podman adds
+// host.containers.internal to the containers itself, which is the host gateway name of Podman targets.
+func (c *podmanClient) ContainerCreate(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, platform *ocispec.Platform, containerName string) (container.CreateResponse, error) {
+	if hostConfig != nil {
+		hostConfig.ExtraHosts = withoutHostGateway(hostConfig.ExtraHosts)
+	}
+	return c.APIClient.ContainerCreate(ctx, config, hostConfig, networkingConfig, platform, containerName)
+}
+
+func withoutHostGateway(extraHosts []string) []string {
+	var hosts []string
+	for _, host := range extraHosts {
+		if strings.HasSuffix(host, ":host-gateway") || strings.HasSuffix(host, "=host-gateway") {
+			continue
+		}
+		hosts = append(hosts, host)
+	}
+	return hosts
+}
@@ -0,0 +1,38 @@
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// recordingClient records the host config of the containers it's asked to create
+type recordingClient struct {
+	client.APIClient
+	hostConfig *container.HostConfig
+}
+
+func (c *recordingClient) ContainerCreate(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, platform *ocispec.Platform, containerName string) (container.CreateResponse, error) {
+	c.hostConfig = hostConfig
+	return container.CreateResponse{}, nil
+}
+
+func TestWithEngine(t *testing.T) {
+	recorder := &recordingClient{}
+
+	cli := WithEngine(recorder, EngineDocker)
+	cli.ContainerCreate(context.Background(), nil, &container.HostConfig{ExtraHosts: []string{"host.docker.internal:host-gateway"}}, nil, nil, "")
+	if len(recorder.hostConfig.ExtraHosts) != 1 {
+		t.Errorf("Expected the extra hosts to be kept for Docker, got %v", recorder.hostConfig.ExtraHosts)
+	}
+
+	cli = WithEngine(recorder, EnginePodman)
+	cli.ContainerCreate(context.Background(), nil, &container.HostConfig{ExtraHosts: []string{"host.docker.internal:host-gateway", "registry:10.0.0.2"}}, nil, nil, "")
+	if len(recorder.hostConfig.ExtraHosts) != 1 || recorder.hostConfig.ExtraHosts[0] != "registry:10.0.0.2" {
+		t.Errorf("Expected only the host-gateway extra hosts to be dropped for Podman, got %v", recorder.hostConfig.ExtraHosts)
+	}
+}
@@ -0,0 +1,112 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/daytonaio/daytona-provider-docker/pkg/ssh_tunnel"
+	"github.com/daytonaio/daytona-provider-docker/pkg/ssh_tunnel/util"
+	"github.com/daytonaio/daytona-provider-docker/pkg/types"
+
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ReverseTunnelFallbackAddress is the address the reverse tunnels listen on when the bridge gateway of the remote
+// host can't be found. The containers can't reach it, but the tunneled port isn't exposed to the network of the host.
+const ReverseTunnelFallbackAddress = "127.0.0.1"
+
+// ReverseTunnelBindAddress returns the address the reverse tunnels listen on on the remote host: the gateway of the
+// default bridge network of the engine, which `host-gateway` resolves to in the containers. Only the host and its
+// containers reach it. Listening on it requires `GatewayPorts clientspecified` in the sshd config of the remote host.
+func ReverseTunnelBindAddress(cli client.APIClient, engine Engine) string {
+	networkName := "bridge"
+	if engine == EnginePodman {
+		networkName = "podman"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), engineDetectTimeout)
+	defer cancel()
+
+	bridge, err := cli.NetworkInspect(ctx, networkName, network.InspectOptions{})
+	if err != nil {
+		log.Warnf("failed to inspect the %s network, the reverse tunnel only listens on the loopback interface: %v", networkName, err)
+		return ReverseTunnelFallbackAddress
+	}
+
+	for _, config := range bridge.IPAM.Config {
+		if ip := net.ParseIP(config.Gateway); ip != nil && ip.To4() != nil {
+			return config.Gateway
+		}
+	}
+
+	log.Warnf("the %s network has no gateway, the reverse tunnel only listens on the loopback interface", networkName)
+	return ReverseTunnelFallbackAddress
+}
+
+var reverseTunnels = map[string]context.CancelFunc{}
+var reverseTunnelsMutex sync.Mutex
+
+// ExposeLocalPort makes a local port reachable on the same port of the bind address of the remote host through a
+// reverse SSH tunnel. The tunnel is started once per remote host and port and kept open for the lifetime of the provider.
+func ExposeLocalPort(targetOptions types.TargetConfigOptions, bindAddress string, port int) error {
+	if targetOptions.RemoteHostname == nil {
+		return nil
+	}
+
+	key := fmt.Sprintf("%s:%d", *targetOptions.RemoteHostname, port)
+	if targetOptions.RemoteUser != nil {
+		key = fmt.Sprintf("%s@%s", *targetOptions.RemoteUser, key)
+	}
+
+	reverseTunnelsMutex.Lock()
+	defer reverseTunnelsMutex.Unlock()
+
+	if _, ok := reverseTunnels[key]; ok {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	startedChan, errChan := util.ForwardLocalToRemote(
+		ctx,
+		targetOptions,
+		ssh_tunnel.NewTCPEndpoint(bindAddress, port),
+		ssh_tunnel.NewTCPEndpoint("localhost", port),
+	)
+
+	select {
+	case <-startedChan:
+	case err := <-errChan:
+		cancel()
+		return fmt.Errorf("failed to expose port %d on %s: %w", port, *targetOptions.RemoteHostname, err)
+	}
+
+	reverseTunnels[key] = cancel
+
+	go func() {
+		err := <-errChan
+		if err != nil {
+			log.Error(err)
+		}
+
+		reverseTunnelsMutex.Lock()
+		delete(reverseTunnels, key)
+		reverseTunnelsMutex.Unlock()
+	}()
+
+	return nil
+}
+
+func closeReverseTunnels() {
+	reverseTunnelsMutex.Lock()
+	defer reverseTunnelsMutex.Unlock()
+
+	for _, cancel := range reverseTunnels {
+		cancel()
+	}
+}
@@ -0,0 +1,61 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/client"
+)
+
+func TestReverseTunnelBindAddress(t *testing.T) {
+	networks := map[string]string{
+		"bridge": `{"Name":"bridge","Driver":"bridge","IPAM":{"Config":[{"Subnet":"172.17.0.0/16","Gateway":"172.17.0.1"}]}}`,
+		"podman": `{"Name":"podman","Driver":"bridge","IPAM":{"Config":[{"Subnet":"fd00::/64","Gateway":"fd00::1"},{"Subnet":"10.88.0.0/16","Gateway":"10.88.0.1"}]}}`,
+	}
+
+	tests := []struct {
+		name     string
+		engine   Engine
+		networks map[string]string
+		expected string
+	}{
+		{name: "docker", engine: EngineDocker, networks: networks, expected: "172.17.0.1"},
+		{name: "podman", engine: EnginePodman, networks: networks, expected: "10.88.0.1"},
+		{name: "no bridge network", engine: EngineDocker, networks: map[string]string{}, expected: ReverseTunnelFallbackAddress},
+		{
+			name:     "no gateway",
+			engine:   EngineDocker,
+			networks: map[string]string{"bridge": `{"Name":"bridge","IPAM":{"Config":[]}}`},
+			expected: ReverseTunnelFallbackAddress,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				name := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+				network, ok := test.networks[name]
+				if !strings.Contains(r.URL.Path, "/networks/") || !ok {
+					http.NotFound(w, r)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(network))
+			}))
+			defer server.Close()
+
+			cli, err := client.NewClientWithOpts(client.WithHost("tcp://"+server.Listener.Addr().String()), client.WithVersion("1.41"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cli.Close()
+
+			address := ReverseTunnelBindAddress(cli, test.engine)
+			if address != test.expected {
+				t.Errorf("Expected the reverse tunnel to listen on %s, got %s", test.expected, address)
+			}
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/daytonaio/daytona-provider-docker/pkg/ssh_tunnel/util"
+	"github.com/daytonaio/daytona-provider-docker/pkg/types"
+
+	"github.com/docker/docker/client"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/sync/singleflight"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// discoveredRemoteSocks caches the sockets discovered on remote hosts by tunnel key, discovery takes a few round trips
+var discoveredRemoteSocks = map[string]string{}
+var discoveredRemoteSocksMutex sync.Mutex
+
+// remoteSockDiscovery runs a single discovery per tunnel key, the discoveries of other targets aren't blocked
+var remoteSockDiscovery singleflight.Group
+
+// SockPath returns the docker socket used for the target: the Sock Path if it's set, otherwise the first socket that
+// answers a ping on the host of the daemon. It's empty for targets reached at a Docker Host URL, through dial-stdio
+// or through a non-unix DOCKER_HOST.
+func SockPath(targetOptions types.TargetConfigOptions) (string, error) {
+	err := targetOptions.ResolveDockerContext()
+	if err != nil {
+		return "", err
+	}
+
+	if targetOptions.IsTcp() {
+		return "", nil
+	}
+
+	if targetOptions.SockPath != nil && *targetOptions.SockPath != "" {
+		return *targetOptions.SockPath, nil
+	}
+
+	if targetOptions.RemoteHostname == nil {
+		return discoverLocalSock()
+	}
+
+	if targetOptions.RemoteConnectionMode != nil && *targetOptions.RemoteConnectionMode == types.RemoteConnectionModeDialStdio {
+		// The docker CLI of the remote host picks the socket
+		return "", nil
+	}
+
+	return discoverRemoteSock(targetOptions)
+}
+
+// sockCandidates returns the sockets probed by the discovery in order: DOCKER_HOST, rootless docker, rootful docker,
+// rootless Podman and rootful Podman
+func sockCandidates(dockerHost, runtimeDir string, uid int) []string {
+	var candidates []string
+	if strings.HasPrefix(dockerHost, "unix://") {
+		candidates = append(candidates, strings.TrimPrefix(dockerHost, "unix://"))
+	}
+
+	userRuntimeDir := fmt.Sprintf("/run/user/%d", uid)
+	if runtimeDir != "" {
+		candidates = append(candidates, path.Join(runtimeDir, "docker.sock"))
+	}
+	candidates = append(candidates, path.Join(userRuntimeDir, "docker.sock"), "/var/run/docker.sock")
+
+	if runtimeDir != "" {
+		candidates = append(candidates, path.Join(runtimeDir, "podman", "podman.sock"))
+	}
+	candidates = append(candidates, path.Join(userRuntimeDir, "podman", "podman.sock"), PodmanRootfulSockPath)
+
+	var unique []string
+	seen := map[string]bool{}
+	for _, candidate := range candidates {
+		if !seen[candidate] {
+			seen[candidate] = true
+			unique = append(unique, candidate)
+		}
+	}
+
+	return unique
+}
+
+// discoverLocalSock returns an empty path if the docker client should be configured from the environment
+func discoverLocalSock() (string, error) {
+	dockerHost := os.Getenv("DOCKER_HOST")
+	if runtime.GOOS == "windows" || (dockerHost != "" && !strings.HasPrefix(dockerHost, "unix://")) {
+		return "", nil
+	}
+
+	candidates := sockCandidates(dockerHost, os.Getenv("XDG_RUNTIME_DIR"), os.Getuid())
+	var failures []*SockError
+	for _, candidate := range candidates {
+		if _, err := os.Stat(candidate); err != nil {
+			continue
+		}
+
+		err := pingDockerSock(candidate)
+		if err != nil {
+			log.Debugf("docker socket %s is not answering: %v", candidate, err)
+			kind := ClassifyError(err)
+			if kind == nil {
+				kind = ErrDaemonNotResponding
+			}
+			failures = append(failures, &SockError{Path: candidate, Kind: kind, Err: err})
+			continue
+		}
+
+		return candidate, nil
+	}
+
+	return "", sockDiscoveryError("", failures, fmt.Errorf("no docker socket answered, tried %s", strings.Join(candidates, ", ")))
+}
+
+func discoverRemoteSock(targetOptions types.TargetConfigOptions) (string, error) {
+	key := tunnelKey(targetOptions)
+
+	discoveredRemoteSocksMutex.Lock()
+	sockPath, ok := discoveredRemoteSocks[key]
+	discoveredRemoteSocksMutex.Unlock()
+	if ok {
+		return sockPath, nil
+	}
+
+	// Concurrent clients of the target wait for the same discovery
+	result, err, _ := remoteSockDiscovery.Do(key, func() (interface{}, error) {
+		return probeRemoteSocks(key, targetOptions)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return result.(string), nil
+}
+
+// probeRemoteSocks pings the candidate sockets on the remote host and caches the first one that answers under key
+func probeRemoteSocks(key string, targetOptions types.TargetConfigOptions) (string, error) {
+	sshClient, release, err := util.GetRemoteClient(targetOptions)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	dockerHost, runtimeDir, uid, err := getRemoteEnv(sshClient)
+	if err != nil {
+		return "", err
+	}
+
+	candidates := sockCandidates(dockerHost, runtimeDir, uid)
+	var failures []*SockError
+	for _, candidate := range candidates {
+		err := pingRemoteDockerSock(sshClient, candidate)
+		if err != nil {
+			log.Debugf("docker socket %s on %s is not answering: %v", candidate, *targetOptions.RemoteHostname, err)
+			// Failed dials are classified already, e.g. a socket the user isn't allowed to use
+			var sockErr *SockError
+			if !errors.As(err, &sockErr) {
+				sockErr = &SockError{Path: candidate, Kind: ErrDaemonNotResponding, Err: err}
+			}
+			if sockErr.Kind != ErrSockNotFound {
+				failures = append(failures, sockErr)
+			}
+			continue
+		}
+
+		log.Infof("using docker socket %s on %s", candidate, *targetOptions.RemoteHostname)
+		discoveredRemoteSocksMutex.Lock()
+		discoveredRemoteSocks[key] = candidate
+		discoveredRemoteSocksMutex.Unlock()
+		return candidate, nil
+	}
+
+	return "", sockDiscoveryError(*targetOptions.RemoteHostname, failures, fmt.Errorf("no docker socket answered, tried %s", strings.Join(candidates, ", ")))
+}
+
+// forgetRemoteSock removes the socket of the target from the discovered sockets once the daemon doesn't answer on
+// it anymore, the next client of the target discovers the socket again
+func forgetRemoteSock(targetOptions types.TargetConfigOptions) {
+	sockPath := remoteSockPath(targetOptions)
+
+	targetOptions.SockPath = nil
+	key := tunnelKey(targetOptions)
+
+	discoveredRemoteSocksMutex.Lock()
+	defer discoveredRemoteSocksMutex.Unlock()
+
+	if discoveredRemoteSocks[key] == sockPath {
+		delete(discoveredRemoteSocks, key)
+	}
+
+	// Another engine may answer on the socket discovered next
+	detectedEnginesMutex.Lock()
+	delete(detectedEngines, engineKey(targetOptions))
+	detectedEnginesMutex.Unlock()
+}
+
+// getRemoteEnv returns DOCKER_HOST, XDG_RUNTIME_DIR and the uid of the remote user
+func getRemoteEnv(sshClient *ssh.Client) (string, string, int, error) {
+	session, err := sshClient.NewSession()
+	if err != nil {
+		return "", "", 0, err
+	}
+	defer session.Close()
+
+	output, err := session.Output(`echo "$DOCKER_HOST"; echo "$XDG_RUNTIME_DIR"; id -u`)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("failed to read the environment of %s: %w", sshClient.RemoteAddr(), err)
+	}
+
+	lines := strings.Split(strings.TrimRight(string(output), "\n"), "\n")
+	if len(lines) != 3 {
+		return "", "", 0, fmt.Errorf("unexpected environment of %s: %q", sshClient.RemoteAddr(), output)
+	}
+
+	uid, err := strconv.Atoi(strings.TrimSpace(lines[2]))
+	if err != nil {
+		return "", "", 0, fmt.Errorf("unexpected uid on %s: %w", sshClient.RemoteAddr(), err)
+	}
+
+	return strings.TrimSpace(lines[0]), strings.TrimSpace(lines[1]), uid, nil
+}
+
+// pingRemoteDockerSock returns the SockError of the dial if the socket couldn't be dialed, the docker client
+// flattens it
+func pingRemoteDockerSock(sshClient *ssh.Client, sockPath string) error {
+	dialErrs := make(chan error, 1)
+	httpClient := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				conn, err := dialRemoteSock(sockPath)(sshClient)
+				if err != nil {
+					select {
+					case dialErrs <- err:
+					default:
+					}
+				}
+				return conn, err
+			},
+		},
+	}
+
+	cli, err := client.NewClientWithOpts(client.WithHost("unix://"+sockPath), client.WithHTTPClient(httpClient))
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), tunnelPingTimeout)
+	defer cancel()
+
+	_, err = cli.Ping(ctx)
+	if err != nil {
+		select {
+		case dialErr := <-dialErrs:
+			return dialErr
+		default:
+		}
+	}
+	if err != nil && errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("timed out after %s", tunnelPingTimeout)
+	}
+	return err
+}
@@ -0,0 +1,157 @@
+package client
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/daytonaio/daytona-provider-docker/pkg/types"
+)
+
+func TestSockCandidates(t *testing.T) {
+	tests := []struct {
+		dockerHost string
+		runtimeDir string
+		uid        int
+		expected   []string
+	}{
+		{
+			uid: 1000,
+			expected: []string{
+				"/run/user/1000/docker.sock",
+				"/var/run/docker.sock",
+				"/run/user/1000/podman/podman.sock",
+				"/run/podman/podman.sock",
+			},
+		},
+		{
+			dockerHost: "unix:///home/alice/.docker/run/docker.sock",
+			runtimeDir: "/run/user/1000",
+			uid:        1000,
+			expected: []string{
+				"/home/alice/.docker/run/docker.sock",
+				"/run/user/1000/docker.sock",
+				"/var/run/docker.sock",
+				"/run/user/1000/podman/podman.sock",
+				"/run/podman/podman.sock",
+			},
+		},
+		{
+			dockerHost: "tcp://docker.example.com:2376",
+			runtimeDir: "/tmp/runtime-bob",
+			uid:        0,
+			expected: []string{
+				"/tmp/runtime-bob/docker.sock",
+				"/run/user/0/docker.sock",
+				"/var/run/docker.sock",
+				"/tmp/runtime-bob/podman/podman.sock",
+				"/run/user/0/podman/podman.sock",
+				"/run/podman/podman.sock",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		candidates := sockCandidates(test.dockerHost, test.runtimeDir, test.uid)
+		if !reflect.DeepEqual(candidates, test.expected) {
+			t.Errorf("Expected candidates %v, got %v", test.expected, candidates)
+		}
+	}
+}
+
+func TestForgetRemoteSock(t *testing.T) {
+	host := "docker.example.com"
+	otherHost := "other.example.com"
+	discovered := "/run/user/1000/docker.sock"
+	other := "/var/run/docker.sock"
+
+	key := tunnelKey(types.TargetConfigOptions{RemoteHostname: &host})
+	otherKey := tunnelKey(types.TargetConfigOptions{RemoteHostname: &otherHost})
+	discoveredRemoteSocks[key] = discovered
+	discoveredRemoteSocks[otherKey] = discovered
+	t.Cleanup(func() {
+		delete(discoveredRemoteSocks, key)
+		delete(discoveredRemoteSocks, otherKey)
+	})
+
+	// A socket set explicitly doesn't clear the discovered one
+	forgetRemoteSock(types.TargetConfigOptions{RemoteHostname: &host, SockPath: &other})
+	if discoveredRemoteSocks[key] != discovered {
+		t.Errorf("Expected the discovered socket to be kept")
+	}
+
+	forgetRemoteSock(types.TargetConfigOptions{RemoteHostname: &host, SockPath: &discovered})
+	if _, ok := discoveredRemoteSocks[key]; ok {
+		t.Errorf("Expected the dead socket to be forgotten")
+	}
+	if discoveredRemoteSocks[otherKey] != discovered {
+		t.Errorf("Expected the socket of the other host to be kept")
+	}
+}
+
+func TestDiscoverRemoteSockDoesNotBlockOtherTargets(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	// The SSH handshake with this host hangs until its connections are closed
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			accepted <- conn
+		}
+	}()
+
+	host := "127.0.0.1"
+	port := listener.Addr().(*net.TCPAddr).Port
+	password := "secret"
+	authMethod := types.AuthMethodPassword
+	hangingDone := make(chan struct{})
+	go func() {
+		defer close(hangingDone)
+		discoverRemoteSock(types.TargetConfigOptions{RemoteHostname: &host, RemotePort: &port, RemotePassword: &password, AuthMethod: &authMethod})
+	}()
+
+	var conn net.Conn
+	select {
+	case conn = <-accepted:
+	case <-time.After(time.Second * 5):
+		t.Fatal("Timed out waiting for the discovery to dial")
+	}
+	defer func() {
+		listener.Close()
+		conn.Close()
+		<-hangingDone
+	}()
+
+	// The socket of another target is read from the cache while the discovery is dialing
+	otherHost := "other.example.com"
+	otherOptions := types.TargetConfigOptions{RemoteHostname: &otherHost}
+	otherKey := tunnelKey(otherOptions)
+	discoveredRemoteSocksMutex.Lock()
+	discoveredRemoteSocks[otherKey] = "/var/run/docker.sock"
+	discoveredRemoteSocksMutex.Unlock()
+	t.Cleanup(func() {
+		discoveredRemoteSocksMutex.Lock()
+		delete(discoveredRemoteSocks, otherKey)
+		discoveredRemoteSocksMutex.Unlock()
+	})
+
+	done := make(chan string, 1)
+	go func() {
+		sockPath, _ := discoverRemoteSock(otherOptions)
+		done <- sockPath
+	}()
+	select {
+	case sockPath := <-done:
+		if sockPath != "/var/run/docker.sock" {
+			t.Errorf("Expected the cached socket, got %s", sockPath)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the discovery of another target not to wait for the SSH connection")
+	}
+}
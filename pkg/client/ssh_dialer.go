@@ -0,0 +1,123 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/daytonaio/daytona-provider-docker/pkg/ssh_tunnel/util"
+	"github.com/daytonaio/daytona-provider-docker/pkg/types"
+
+	"github.com/docker/docker/client"
+	"golang.org/x/crypto/ssh"
+)
+
+// sshIdleConnTimeout closes idle API connections so the pooled SSH connections they use can be released
+const sshIdleConnTimeout = 30 * time.Second
+
+// getSshDialedClient returns a docker client that opens every API connection with dial over a pooled SSH
+// connection, without a local socket file.
+func getSshDialedClient(targetOptions types.TargetConfigOptions, dial func(sshClient *ssh.Client) (net.Conn, error)) (*client.Client, error) {
+	if targetOptions.RemoteHostname == nil {
+		return nil, errors.New("Remote Hostname is required")
+	}
+
+	dialer := &sshDialer{
+		targetOptions: targetOptions,
+		dial:          dial,
+	}
+
+	httpClient := &http.Client{
+		Transport: &http.Transport{
+			DialContext:     dialer.DialContext,
+			IdleConnTimeout: sshIdleConnTimeout,
+		},
+		CheckRedirect: client.CheckRedirect,
+	}
+
+	return client.NewClientWithOpts(
+		// The host is only used for the requests, the connections are made by the dialer
+		client.WithHost(fmt.Sprintf("unix://%s", remoteSockPath(targetOptions))),
+		client.WithHTTPClient(httpClient),
+		client.WithAPIVersionNegotiation(),
+	)
+}
+
+// dialRemoteSock returns a dial function that opens a `direct-streamlocal` channel to the socket
+func dialRemoteSock(sockPath string) func(sshClient *ssh.Client) (net.Conn, error) {
+	return func(sshClient *ssh.Client) (net.Conn, error) {
+		conn, err := sshClient.Dial("unix", sockPath)
+		if err != nil {
+			return nil, checkRemoteSock(sshClient, sockPath, fmt.Errorf("failed to dial %s on %s: %w", sockPath, sshClient.RemoteAddr(), err))
+		}
+		return conn, nil
+	}
+}
+
+// sshDialer opens connections over the pooled SSH connections of the target. It doesn't keep a SSH tunnel, the
+// pool only creates one when it doesn't hold a connection for the target, so concurrent dials don't share one.
+type sshDialer struct {
+	targetOptions types.TargetConfigOptions
+	dial          func(sshClient *ssh.Client) (net.Conn, error)
+}
+
+func (d *sshDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	type dialResult struct {
+		conn    net.Conn
+		release func()
+		err     error
+	}
+
+	resultChan := make(chan dialResult, 1)
+	go func() {
+		sshClient, release, err := util.GetRemoteClient(d.targetOptions)
+		if err != nil {
+			resultChan <- dialResult{err: err}
+			return
+		}
+
+		conn, err := d.dial(sshClient)
+		if err != nil {
+			release()
+			resultChan <- dialResult{err: err}
+			return
+		}
+
+		resultChan <- dialResult{conn: conn, release: release}
+	}()
+
+	select {
+	case result := <-resultChan:
+		if result.err != nil {
+			return nil, result.err
+		}
+		return &pooledConn{Conn: result.conn, release: result.release}, nil
+	case <-ctx.Done():
+		// Clean up once the dial finishes
+		go func() {
+			result := <-resultChan
+			if result.err == nil {
+				result.conn.Close()
+				result.release()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// pooledConn releases the SSH connection it was opened on when it's closed
+type pooledConn struct {
+	net.Conn
+	release   func()
+	closeOnce sync.Once
+}
+
+func (c *pooledConn) Close() error {
+	err := c.Conn.Close()
+	c.closeOnce.Do(c.release)
+	return err
+}
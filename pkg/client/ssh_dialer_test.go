@@ -0,0 +1,110 @@
+package client
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/daytonaio/daytona-provider-docker/pkg/types"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// startSshServer starts a SSH server accepting the password and returns its port and the number of connections
+func startSshServer(t *testing.T, password string) (int, *atomic.Int32) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostKey, err := ssh.NewSignerFromKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, received []byte) (*ssh.Permissions, error) {
+			if string(received) != password {
+				return nil, ssh.ErrNoAuth
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	var conns atomic.Int32
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, chans, reqs, err := ssh.NewServerConn(conn, config)
+				if err != nil {
+					conn.Close()
+					return
+				}
+				conns.Add(1)
+				go ssh.DiscardRequests(reqs)
+				for newChannel := range chans {
+					newChannel.Reject(ssh.Prohibited, "no channels")
+				}
+			}()
+		}
+	}()
+
+	return listener.Addr().(*net.TCPAddr).Port, &conns
+}
+
+func TestSshDialerConcurrentDials(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	port, conns := startSshServer(t, "secret")
+
+	host := "127.0.0.1"
+	password := "secret"
+	authMethod := types.AuthMethodPassword
+	hostKeyPolicy := "insecure"
+	dialer := &sshDialer{
+		targetOptions: types.TargetConfigOptions{
+			RemoteHostname: &host,
+			RemotePort:     &port,
+			RemotePassword: &password,
+			AuthMethod:     &authMethod,
+			HostKeyPolicy:  &hostKeyPolicy,
+		},
+		dial: func(sshClient *ssh.Client) (net.Conn, error) {
+			conn, _ := net.Pipe()
+			return conn, nil
+		},
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			conn, err := dialer.DialContext(context.Background(), "unix", "docker.sock")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			conn.Close()
+		}()
+	}
+	wg.Wait()
+
+	if conns.Load() != 1 {
+		t.Errorf("Expected the dials to share one SSH connection, got %d", conns.Load())
+	}
+}
@@ -0,0 +1,343 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/daytonaio/daytona-provider-docker/pkg/ssh_tunnel"
+	"github.com/daytonaio/daytona-provider-docker/pkg/ssh_tunnel/util"
+	"github.com/daytonaio/daytona-provider-docker/pkg/types"
+
+	"github.com/docker/docker/client"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// tunnelPingTimeout is how long the docker daemon has to answer through an existing tunnel before it's rebuilt
+const tunnelPingTimeout = 5 * time.Second
+
+// DefaultTunnelManager keeps the docker socket tunnels of the provider
+var DefaultTunnelManager = NewTunnelManager()
+
+// TunnelManager starts the tunnels forwarding the docker sockets of remote targets. Tunnels are keyed by the
+// user, host, port, jump hosts, credentials and socket path of the target and are reused only while the docker
+// daemon answers through them.
+type TunnelManager struct {
+	mutex   sync.Mutex
+	tunnels map[string]*dockerSockTunnel
+}
+
+type dockerSockTunnel struct {
+	key            string
+	localSockPath  string
+	remoteSockPath string
+	startedAt      time.Time
+	cancel         context.CancelFunc
+	// ready is closed once the tunnel started or failed to, startErr is set before
+	ready    chan struct{}
+	startErr error
+	done     chan struct{}
+	// err is set before done is closed
+	err error
+}
+
+// TunnelInfo describes a docker socket tunnel (useful for diagnostics).
+type TunnelInfo struct {
+	Key            string
+	LocalSockPath  string
+	RemoteSockPath string
+	StartedAt      time.Time
+	Running        bool
+	Error          error
+}
+
+func NewTunnelManager() *TunnelManager {
+	return &TunnelManager{
+		tunnels: map[string]*dockerSockTunnel{},
+	}
+}
+
+// ForwardDockerSock returns a local socket in sockDir forwarded to the docker socket of the remote host of the target.
+// An existing tunnel is reused if the docker daemon answers a ping through it, otherwise the tunnel is rebuilt.
+// Concurrent calls for the same tunnel wait for a single start, the tunnels of other targets aren't blocked.
+func (m *TunnelManager) ForwardDockerSock(targetOptions types.TargetConfigOptions, sockDir string) (string, error) {
+	key := tunnelKey(targetOptions)
+
+	for {
+		m.mutex.Lock()
+		tunnel, ok := m.tunnels[key]
+		m.mutex.Unlock()
+
+		if ok {
+			<-tunnel.ready
+			if tunnel.startErr != nil {
+				return "", tunnel.startErr
+			}
+
+			err := tunnel.check()
+			if err == nil {
+				return tunnel.localSockPath, nil
+			}
+
+			// The socket may have moved, e.g. after docker was reinstalled as rootless
+			forgetRemoteSock(targetOptions)
+
+			m.mutex.Lock()
+			if m.tunnels[key] != tunnel {
+				// Another caller is rebuilding it already
+				m.mutex.Unlock()
+				continue
+			}
+			log.Warnf("docker socket tunnel %s is not responding, rebuilding it: %v", key, err)
+		} else {
+			m.mutex.Lock()
+			if _, ok := m.tunnels[key]; ok {
+				m.mutex.Unlock()
+				continue
+			}
+		}
+
+		newTunnel := &dockerSockTunnel{
+			key:            key,
+			localSockPath:  filepath.Join(sockDir, fmt.Sprintf("daytona-%s-docker.sock", sockHash(key))),
+			remoteSockPath: remoteSockPath(targetOptions),
+			ready:          make(chan struct{}),
+			done:           make(chan struct{}),
+		}
+		m.tunnels[key] = newTunnel
+		m.mutex.Unlock()
+
+		// The old tunnel uses the same local socket, it has to be gone before the new one listens
+		if ok {
+			tunnel.stop()
+		}
+
+		newTunnel.startErr = m.start(newTunnel, targetOptions, sockDir)
+		close(newTunnel.ready)
+
+		if newTunnel.startErr != nil {
+			m.mutex.Lock()
+			if m.tunnels[key] == newTunnel {
+				delete(m.tunnels, key)
+			}
+			m.mutex.Unlock()
+			return "", newTunnel.startErr
+		}
+
+		return newTunnel.localSockPath, nil
+	}
+}
+
+// start dials the remote host and starts forwarding the socket. The manager's mutex isn't held, dialing may take
+// minutes while the SSH connection is retried.
+func (m *TunnelManager) start(tunnel *dockerSockTunnel, targetOptions types.TargetConfigOptions, sockDir string) error {
+	err := os.MkdirAll(sockDir, 0755)
+	if err != nil {
+		return err
+	}
+
+	// A socket left behind by a tunnel that isn't running anymore would make listening fail
+	err = os.Remove(tunnel.localSockPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	startedChan, errChan := util.ForwardRemoteUnixSock(ctx, targetOptions, tunnel.localSockPath, tunnel.remoteSockPath)
+
+	select {
+	case <-startedChan:
+	case err := <-errChan:
+		cancel()
+		os.Remove(tunnel.localSockPath)
+		close(tunnel.done)
+		return fmt.Errorf("failed to forward the docker socket of %s: %w", *targetOptions.RemoteHostname, err)
+	}
+
+	tunnel.startedAt = time.Now()
+	tunnel.cancel = cancel
+
+	go func() {
+		err := <-errChan
+		if err != nil {
+			log.Error(err)
+		}
+		tunnel.err = err
+		close(tunnel.done)
+	}()
+
+	// The socket is forwarded even if it doesn't exist on the remote host, the ping finds out
+	err = pingDockerSock(tunnel.localSockPath)
+	if err != nil {
+		tunnel.stop()
+		forgetRemoteSock(targetOptions)
+		return diagnoseRemoteSock(targetOptions, tunnel.remoteSockPath, err)
+	}
+
+	return nil
+}
+
+// List returns the docker socket tunnels started by the manager.
+func (m *TunnelManager) List() []TunnelInfo {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var infos []TunnelInfo
+	for _, tunnel := range m.tunnels {
+		if !tunnel.started() {
+			continue
+		}
+
+		info := TunnelInfo{
+			Key:            tunnel.key,
+			LocalSockPath:  tunnel.localSockPath,
+			RemoteSockPath: tunnel.remoteSockPath,
+			StartedAt:      tunnel.startedAt,
+			Running:        tunnel.running(),
+		}
+		if !info.Running {
+			info.Error = tunnel.err
+		}
+		infos = append(infos, info)
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Key < infos[j].Key
+	})
+
+	return infos
+}
+
+// Close stops all the tunnels and removes their sockets.
+func (m *TunnelManager) Close() {
+	m.mutex.Lock()
+	tunnels := m.tunnels
+	m.tunnels = map[string]*dockerSockTunnel{}
+	m.mutex.Unlock()
+
+	for _, tunnel := range tunnels {
+		if tunnel.started() {
+			tunnel.stop()
+		}
+	}
+}
+
+// stop stops the tunnel and removes its socket
+func (t *dockerSockTunnel) stop() {
+	t.cancel()
+
+	select {
+	case <-t.done:
+	case <-time.After(tunnelPingTimeout):
+		log.Warnf("docker socket tunnel %s did not stop in time", t.key)
+	}
+
+	os.Remove(t.localSockPath)
+}
+
+// started reports whether the tunnel finished starting successfully
+func (t *dockerSockTunnel) started() bool {
+	select {
+	case <-t.ready:
+		return t.startErr == nil
+	default:
+		return false
+	}
+}
+
+func (t *dockerSockTunnel) running() bool {
+	select {
+	case <-t.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// check returns why the docker daemon doesn't answer through the tunnel, nil if it does
+func (t *dockerSockTunnel) check() error {
+	if !t.running() {
+		return fmt.Errorf("tunnel stopped: %v", t.err)
+	}
+	return pingDockerSock(t.localSockPath)
+}
+
+// Shutdown stops all the tunnels and closes the SSH connections of the provider. It should be called when the
+// plugin exits.
+func Shutdown() {
+	DefaultTunnelManager.Close()
+	closeReverseTunnels()
+	ssh_tunnel.DefaultPool.Close()
+}
+
+// tunnelKey identifies the docker socket a tunnel forwards, e.g. `user@host:22/var/run/docker.sock via user@bastion:22
+// #1a2b3c4d5e6f7a8b`. The host and the jump hosts are resolved through the ssh config. The credentials, the auth method
+// and the host key settings are only included as a hash, so the key can be shown in diagnostics.
+func tunnelKey(targetOptions types.TargetConfigOptions) string {
+	connectionKey := util.ConnectionKey(targetOptions)
+	targetOptions = util.ResolveSshConfig(targetOptions)
+
+	key := hostKey(*targetOptions.RemoteHostname, targetOptions.RemotePort, targetOptions.RemoteUser) + remoteSockPath(targetOptions)
+
+	if targetOptions.JumpHosts != nil && len(*targetOptions.JumpHosts) > 0 {
+		var jumpHosts []string
+		for _, jumpHost := range *targetOptions.JumpHosts {
+			port := jumpHost.Port
+			jumpHosts = append(jumpHosts, hostKey(jumpHost.Host, &port, &jumpHost.User))
+		}
+		key += " via " + strings.Join(jumpHosts, ",")
+	}
+
+	return key + " #" + sockHash(connectionKey)
+}
+
+func hostKey(host string, port *int, user *string) string {
+	key := host
+	if port != nil && *port != 0 {
+		key = fmt.Sprintf("%s:%d", key, *port)
+	} else {
+		key += ":22"
+	}
+	if user != nil && *user != "" {
+		key = fmt.Sprintf("%s@%s", *user, key)
+	}
+	return key
+}
+
+// sockHash keeps the socket paths short, unix socket paths are limited to about 100 characters
+func sockHash(key string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(key)))[:16]
+}
+
+// diagnoseRemoteSock returns a SockError explaining why the docker daemon doesn't answer on the remote socket
+func diagnoseRemoteSock(targetOptions types.TargetConfigOptions, sockPath string, cause error) error {
+	sshClient, release, err := util.GetRemoteClient(targetOptions)
+	if err != nil {
+		return &SockError{Host: *targetOptions.RemoteHostname, Path: sockPath, Kind: ErrDaemonNotResponding, Err: cause}
+	}
+	defer release()
+
+	return checkRemoteSock(sshClient, sockPath, cause)
+}
+
+func pingDockerSock(sockPath string) error {
+	cli, err := client.NewClientWithOpts(client.WithHost(fmt.Sprintf("unix://%s", sockPath)), client.WithAPIVersionNegotiation())
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), tunnelPingTimeout)
+	defer cancel()
+
+	_, err = cli.Ping(ctx)
+	return err
+}
@@ -0,0 +1,97 @@
+package client
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/daytonaio/daytona-provider-docker/pkg/types"
+)
+
+func TestTunnelKey(t *testing.T) {
+	// No ssh config applies to the hosts
+	t.Setenv("HOME", t.TempDir())
+
+	host := "docker.example.com"
+	alice := "alice"
+	bob := "bob"
+	port := 2222
+	sockPath := "/run/user/1000/docker.sock"
+
+	tests := []struct {
+		options  types.TargetConfigOptions
+		expected string
+	}{
+		{
+			options:  types.TargetConfigOptions{RemoteHostname: &host},
+			expected: "docker.example.com:22/var/run/docker.sock",
+		},
+		{
+			options:  types.TargetConfigOptions{RemoteHostname: &host, RemoteUser: &alice},
+			expected: "alice@docker.example.com:22/var/run/docker.sock",
+		},
+		{
+			options:  types.TargetConfigOptions{RemoteHostname: &host, RemoteUser: &bob, RemotePort: &port},
+			expected: "bob@docker.example.com:2222/var/run/docker.sock",
+		},
+		{
+			options:  types.TargetConfigOptions{RemoteHostname: &host, RemoteUser: &bob, SockPath: &sockPath},
+			expected: "bob@docker.example.com:22/run/user/1000/docker.sock",
+		},
+		{
+			options:  types.TargetConfigOptions{RemoteHostname: &host, JumpHosts: &types.JumpHosts{{Host: "bastion", User: "admin"}}},
+			expected: "docker.example.com:22/var/run/docker.sock via admin@bastion:22",
+		},
+	}
+
+	sockHashes := map[string]bool{}
+	for _, test := range tests {
+		key := tunnelKey(test.options)
+		if !strings.HasPrefix(key, test.expected+" #") {
+			t.Errorf("Expected key %s followed by the credentials hash, got %s", test.expected, key)
+		}
+
+		sockHashes[sockHash(key)] = true
+	}
+
+	if len(sockHashes) != len(tests) {
+		t.Errorf("Expected a different socket for every key")
+	}
+}
+
+func TestTunnelKeyCredentials(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	host := "docker.example.com"
+	key := tunnelKey(types.TargetConfigOptions{RemoteHostname: &host})
+
+	password := "env:DOCKER_PASSWORD"
+	authMethod := types.AuthMethodPassword
+	hostKeyPolicy := "strict"
+	others := map[string]types.TargetConfigOptions{
+		"password":        {RemoteHostname: &host, RemotePassword: &password},
+		"auth method":     {RemoteHostname: &host, AuthMethod: &authMethod},
+		"host key policy": {RemoteHostname: &host, HostKeyPolicy: &hostKeyPolicy},
+	}
+	for name, options := range others {
+		if tunnelKey(options) == key {
+			t.Errorf("Expected another %s to change the key", name)
+		}
+	}
+
+	// An alias of the ssh config gets the key of the host it resolves to
+	err := os.MkdirAll(filepath.Join(home, ".ssh"), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(home, ".ssh", "config"), []byte("Host prod\n    HostName docker.example.com\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alias := "prod"
+	if aliasKey := tunnelKey(types.TargetConfigOptions{RemoteHostname: &alias}); aliasKey != key {
+		t.Errorf("Expected the alias to resolve to %s, got %s", key, aliasKey)
+	}
+}
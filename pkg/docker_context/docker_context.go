@@ -0,0 +1,157 @@
+package docker_context
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// DefaultContextName is the context of the docker CLI that isn't stored, it uses DOCKER_HOST or the local socket
+const DefaultContextName = "default"
+
+// Context is a docker endpoint managed with `docker context`
+type Context struct {
+	Name          string
+	Description   string
+	Host          string
+	SkipTLSVerify bool
+	// Paths of the TLS material of the context, empty if the context has none
+	TlsCaCert string
+	TlsCert   string
+	TlsKey    string
+}
+
+type contextMeta struct {
+	Name     string `json:"Name"`
+	Metadata struct {
+		Description string `json:"Description"`
+	} `json:"Metadata"`
+	Endpoints map[string]struct {
+		Host          string `json:"Host"`
+		SkipTLSVerify bool   `json:"SkipTLSVerify"`
+	} `json:"Endpoints"`
+}
+
+// Get returns the context with the given name from the context store of the docker CLI
+func Get(name string) (*Context, error) {
+	if name == DefaultContextName {
+		return &Context{
+			Name: DefaultContextName,
+			Host: os.Getenv("DOCKER_HOST"),
+		}, nil
+	}
+
+	configDir, err := configDir()
+	if err != nil {
+		return nil, err
+	}
+
+	id := contextId(name)
+
+	context, err := readContext(configDir, id)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("docker context %s not found", name)
+		}
+		return nil, err
+	}
+
+	return context, nil
+}
+
+// List returns the contexts in the context store of the docker CLI, sorted by name. The default context isn't included.
+func List() ([]Context, error) {
+	configDir, err := configDir()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(filepath.Join(configDir, "contexts", "meta"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var contexts []Context
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		context, err := readContext(configDir, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		contexts = append(contexts, *context)
+	}
+
+	sort.Slice(contexts, func(i, j int) bool {
+		return contexts[i].Name < contexts[j].Name
+	})
+
+	return contexts, nil
+}
+
+func readContext(configDir, id string) (*Context, error) {
+	content, err := os.ReadFile(filepath.Join(configDir, "contexts", "meta", id, "meta.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var meta contextMeta
+	err = json.Unmarshal(content, &meta)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse docker context %s: %w", id, err)
+	}
+
+	endpoint, ok := meta.Endpoints["docker"]
+	if !ok {
+		return nil, fmt.Errorf("docker context %s has no docker endpoint", meta.Name)
+	}
+
+	context := &Context{
+		Name:          meta.Name,
+		Description:   meta.Metadata.Description,
+		Host:          endpoint.Host,
+		SkipTLSVerify: endpoint.SkipTLSVerify,
+	}
+
+	tlsDir := filepath.Join(configDir, "contexts", "tls", id, "docker")
+	context.TlsCaCert = existingFile(filepath.Join(tlsDir, "ca.pem"))
+	context.TlsCert = existingFile(filepath.Join(tlsDir, "cert.pem"))
+	context.TlsKey = existingFile(filepath.Join(tlsDir, "key.pem"))
+
+	return context, nil
+}
+
+// configDir returns the config directory of the docker CLI, DOCKER_CONFIG or ~/.docker
+func configDir() (string, error) {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return dir, nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(homeDir, ".docker"), nil
+}
+
+// contextId is the name of the directories the docker CLI stores a context in
+func contextId(name string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(name)))
+}
+
+func existingFile(path string) string {
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
@@ -0,0 +1,78 @@
+package docker_context
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeContext(t *testing.T, configDir, name, host string, tlsFiles ...string) {
+	id := contextId(name)
+
+	metaDir := filepath.Join(configDir, "contexts", "meta", id)
+	err := os.MkdirAll(metaDir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	meta := `{"Name":"` + name + `","Metadata":{"Description":"` + name + ` hosts"},"Endpoints":{"docker":{"Host":"` + host + `","SkipTLSVerify":false}}}`
+	err = os.WriteFile(filepath.Join(metaDir, "meta.json"), []byte(meta), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tlsDir := filepath.Join(configDir, "contexts", "tls", id, "docker")
+	for _, file := range tlsFiles {
+		err = os.MkdirAll(tlsDir, 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(filepath.Join(tlsDir, file), []byte("pem"), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestContexts(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv("DOCKER_CONFIG", configDir)
+
+	writeContext(t, configDir, "staging", "ssh://alice@staging.example.com:2222")
+	writeContext(t, configDir, "prod", "tcp://prod.example.com:2376", "ca.pem", "cert.pem", "key.pem")
+
+	contexts, err := List()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(contexts) != 2 || contexts[0].Name != "prod" || contexts[1].Name != "staging" {
+		t.Fatalf("Expected the prod and staging contexts, got %+v", contexts)
+	}
+
+	prod, err := Get("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if prod.Host != "tcp://prod.example.com:2376" || prod.Description != "prod hosts" {
+		t.Errorf("Unexpected prod context %+v", prod)
+	}
+	if prod.TlsKey != filepath.Join(configDir, "contexts", "tls", contextId("prod"), "docker", "key.pem") {
+		t.Errorf("Unexpected TLS key path %s", prod.TlsKey)
+	}
+
+	staging, err := Get("staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if staging.TlsCaCert != "" {
+		t.Errorf("Expected no TLS material in the staging context, got %s", staging.TlsCaCert)
+	}
+
+	_, err = Get("missing")
+	if err == nil {
+		t.Errorf("Expected an error for a missing context")
+	}
+}
@@ -5,16 +5,24 @@ import (
 	"io"
 
 	log_writers "github.com/daytonaio/daytona-provider-docker/internal/log"
+	"github.com/daytonaio/daytona-provider-docker/pkg/client"
 	"github.com/daytonaio/daytona-provider-docker/pkg/types"
 
 	"github.com/daytonaio/daytona/pkg/docker"
 	"github.com/daytonaio/daytona/pkg/logs"
+	"github.com/daytonaio/daytona/pkg/models"
 	"github.com/daytonaio/daytona/pkg/provider"
 	provider_util "github.com/daytonaio/daytona/pkg/provider/util"
 	"github.com/daytonaio/daytona/pkg/ssh"
 )
 
 func (p DockerProvider) CreateTarget(targetReq *provider.TargetRequest) (*provider_util.Empty, error) {
+	// Parses and validates the target options before anything is created
+	dockerClient, err := p.getClient(targetReq.Target.TargetConfig.Options)
+	if err != nil {
+		return new(provider_util.Empty), err
+	}
+
 	logWriter := io.MultiWriter(&log_writers.InfoLogWriter{})
 	if p.TargetLogsDir != nil {
 		loggerFactory := logs.NewLoggerFactory(logs.LoggerFactoryConfig{
@@ -31,25 +39,28 @@ func (p DockerProvider) CreateTarget(targetReq *provider.TargetRequest) (*provid
 		defer targetLogWriter.Close()
 	}
 
-	dockerClient, err := p.getClient(targetReq.Target.TargetConfig.Options)
+	targetDir, err := p.getTargetDir(targetReq)
 	if err != nil {
 		return new(provider_util.Empty), err
 	}
 
-	targetDir, err := p.getTargetDir(targetReq)
+	targetOptions, _, err := types.ParseTargetConfigOptions(targetReq.Target.TargetConfig.Options)
 	if err != nil {
 		return new(provider_util.Empty), err
 	}
 
-	sshClient, err := p.getSshClient(targetReq.Target.TargetConfig.Options)
+	// Without SSH, the docker client would create the directory on the runner
+	if targetOptions.IsTcp() {
+		return new(provider_util.Empty), withHint(client.CreateDaemonDir(*targetOptions, p.RemoteSockDir, targetDir))
+	}
+
+	sshClient, releaseSshClient, err := p.getSshClient(targetReq.Target.TargetConfig.Options)
 	if err != nil {
 		return new(provider_util.Empty), err
 	}
-	if sshClient != nil {
-		defer sshClient.Close()
-	}
+	defer releaseSshClient()
 
-	return new(provider_util.Empty), dockerClient.CreateTarget(targetReq.Target, targetDir, logWriter, sshClient)
+	return new(provider_util.Empty), withHint(dockerClient.CreateTarget(targetReq.Target, targetDir, logWriter, sshClient))
 }
 
 func (p DockerProvider) CreateWorkspace(workspaceReq *provider.WorkspaceRequest) (*provider_util.Empty, error) {
@@ -57,6 +68,12 @@ func (p DockerProvider) CreateWorkspace(workspaceReq *provider.WorkspaceRequest)
 		return new(provider_util.Empty), errors.New("ServerDownloadUrl not set. Did you forget to call Initialize?")
 	}
 
+	// Parses and validates the target options before anything is created
+	dockerClient, err := p.getClient(workspaceReq.Workspace.Target.TargetConfig.Options)
+	if err != nil {
+		return new(provider_util.Empty), err
+	}
+
 	logWriter := io.MultiWriter(&log_writers.InfoLogWriter{})
 	if p.WorkspaceLogsDir != nil {
 		loggerFactory := logs.NewLoggerFactory(logs.LoggerFactoryConfig{
@@ -73,34 +90,49 @@ func (p DockerProvider) CreateWorkspace(workspaceReq *provider.WorkspaceRequest)
 		defer workspaceLogWriter.Close()
 	}
 
-	dockerClient, err := p.getClient(workspaceReq.Workspace.Target.TargetConfig.Options)
-	if err != nil {
-		return new(provider_util.Empty), err
-	}
-
 	workspaceDir, err := p.getWorkspaceDir(workspaceReq)
 	if err != nil {
 		return new(provider_util.Empty), err
 	}
 
-	_, isLocal, err := types.ParseTargetConfigOptions(workspaceReq.Workspace.Target.TargetConfig.Options)
+	targetOptions, isLocal, err := types.ParseTargetConfigOptions(workspaceReq.Workspace.Target.TargetConfig.Options)
 	if err != nil {
 		return new(provider_util.Empty), err
 	}
 
+	workspace := workspaceReq.Workspace
 	var sshClient *ssh.Client
 	if !isLocal {
-		sshClient, err = p.getSshClient(workspaceReq.Workspace.Target.TargetConfig.Options)
+		if targetOptions.IsTcp() {
+			workspace, err = tcpWorkspace(workspace)
+			if err != nil {
+				return new(provider_util.Empty), err
+			}
+
+			// Without SSH, the directory of the workspace can't be created on the docker host by the client
+			err = client.CreateDaemonDir(*targetOptions, p.RemoteSockDir, workspaceDir)
+			if err != nil {
+				return new(provider_util.Empty), withHint(err)
+			}
+		}
+
+		var releaseSshClient func()
+		sshClient, releaseSshClient, err = p.getSshClient(workspaceReq.Workspace.Target.TargetConfig.Options)
 		if err != nil {
 			return new(provider_util.Empty), err
 		}
-		if sshClient != nil {
-			defer sshClient.Close()
+		defer releaseSshClient()
+
+		// The repository isn't cloned yet so only an explicit devcontainer build config can be detected here
+		buildConfig := workspace.BuildConfig
+		isDevcontainer := buildConfig != nil && buildConfig.Devcontainer != nil
+		if targetOptions.RemoteHostname != nil && targetOptions.ExposeServerApi != nil && *targetOptions.ExposeServerApi && !isDevcontainer {
+			setExposedServerApiUrl(workspace, p.getHostGatewayName(*targetOptions), *p.ApiPort)
 		}
 	}
 
-	return new(provider_util.Empty), dockerClient.CreateWorkspace(&docker.CreateWorkspaceOptions{
-		Workspace:           workspaceReq.Workspace,
+	err = dockerClient.CreateWorkspace(&docker.CreateWorkspaceOptions{
+		Workspace:           workspace,
 		WorkspaceDir:        workspaceDir,
 		ContainerRegistries: workspaceReq.ContainerRegistries,
 		BuilderImage:        workspaceReq.BuilderImage,
@@ -108,4 +140,23 @@ func (p DockerProvider) CreateWorkspace(workspaceReq *provider.WorkspaceRequest)
 		Gpc:                 workspaceReq.GitProviderConfig,
 		SshClient:           sshClient,
 	})
+
+	return new(provider_util.Empty), withHint(err)
+}
+
+// tcpWorkspace returns the workspace the docker client creates and starts on a target reached over TCP. Without a
+// SSH client, the docker client clones the repository and detects and writes the devcontainer files in the
+// workspace directory on the runner, while the containers bind it from the host of the daemon. The build config is
+// therefore dropped, so the repository is cloned in the workspace container, and devcontainer builds are refused.
+func tcpWorkspace(workspace *models.Workspace) (*models.Workspace, error) {
+	if workspace.BuildConfig == nil {
+		return workspace, nil
+	}
+	if workspace.BuildConfig.Devcontainer != nil {
+		return nil, errors.New("devcontainer builds are not supported on targets with a Docker Host URL, the devcontainer files would be read from the runner instead of the docker host")
+	}
+
+	withoutBuild := *workspace
+	withoutBuild.BuildConfig = nil
+	return &withoutBuild, nil
 }
@@ -0,0 +1,129 @@
+package provider
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/daytonaio/daytona-provider-docker/pkg/client"
+
+	"github.com/daytonaio/daytona/pkg/gitprovider"
+	"github.com/daytonaio/daytona/pkg/models"
+	"github.com/daytonaio/daytona/pkg/provider"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// tcpDaemon answers the requests of a workspace creation and records the images of the containers it creates
+type tcpDaemon struct {
+	mutex  sync.Mutex
+	images []string
+	// logs is closed once the logs of the workspace are read
+	logs     chan struct{}
+	logsOnce sync.Once
+}
+
+func (d *tcpDaemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/_ping"):
+		w.Header().Set("Api-Version", "1.41")
+		w.Write([]byte("OK"))
+	case strings.HasSuffix(r.URL.Path, "/images/json"):
+		w.Write([]byte(`[{"RepoTags":["daytonaio/workspace-project:1.0"]}]`))
+	case strings.HasSuffix(r.URL.Path, "/containers/create"):
+		var req container.CreateRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		d.mutex.Lock()
+		d.images = append(d.images, req.Image)
+		d.mutex.Unlock()
+		w.Write([]byte(`{"Id":"test"}`))
+	case strings.HasSuffix(r.URL.Path, "/wait"):
+		w.Write([]byte(`{"StatusCode":0}`))
+	case strings.HasSuffix(r.URL.Path, "/containers/test/json"):
+		w.Write([]byte(`{"Config":{"Tty":true}}`))
+	case strings.HasSuffix(r.URL.Path, "/logs"):
+		w.Header().Set("Content-Type", "application/vnd.docker.raw-stream")
+		d.logsOnce.Do(func() { close(d.logs) })
+	case r.Method == http.MethodPost || r.Method == http.MethodDelete:
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Write([]byte(`{}`))
+	}
+}
+
+func TestCreateWorkspaceOverTcp(t *testing.T) {
+	daemon := &tcpDaemon{logs: make(chan struct{})}
+	server := httptest.NewServer(daemon)
+	defer server.Close()
+	// The docker client reads the logs in the background, they're retried until the server answers
+	defer func() {
+		select {
+		case <-daemon.logs:
+		case <-time.After(time.Second * 5):
+		}
+	}()
+
+	// The data dir is a path of the docker host, it must not be created on the runner
+	dataDir := path.Join(t.TempDir(), "data")
+	options, err := json.Marshal(map[string]string{
+		"Docker Host URL": "tcp://" + server.Listener.Addr().String(),
+		"Target Data Dir": dataDir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	downloadUrl := "http://localhost:3986/binary"
+	dockerProvider := DockerProvider{DaytonaDownloadUrl: &downloadUrl, RemoteSockDir: t.TempDir()}
+	workspace := &models.Workspace{
+		Id:          "workspace",
+		Name:        "test",
+		Image:       "daytonaio/workspace-project:1.0",
+		User:        "daytona",
+		BuildConfig: &models.BuildConfig{},
+		Repository: &gitprovider.GitRepository{
+			Url:  "https://github.com/daytonaio/daytona",
+			Name: "daytona",
+		},
+		Target: models.Target{
+			Id: "target",
+			TargetConfig: models.TargetConfig{
+				ProviderInfo: models.ProviderInfo{Name: "docker-provider"},
+				Options:      string(options),
+			},
+		},
+	}
+
+	_, err = dockerProvider.CreateWorkspace(&provider.WorkspaceRequest{Workspace: workspace, BuilderImage: workspace.Image})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(dataDir); !os.IsNotExist(err) {
+		t.Errorf("Expected the workspace directory not to be created on the runner, got %v", err)
+	}
+
+	daemon.mutex.Lock()
+	defer daemon.mutex.Unlock()
+	if len(daemon.images) != 2 || daemon.images[0] != client.DaemonDirImage || daemon.images[1] != workspace.Image {
+		t.Errorf("Expected the directory to be created on the docker host before the workspace, got %v", daemon.images)
+	}
+}
+
+func TestTcpWorkspaceDevcontainer(t *testing.T) {
+	workspace := &models.Workspace{
+		BuildConfig: &models.BuildConfig{Devcontainer: &models.DevcontainerConfig{FilePath: ".devcontainer/devcontainer.json"}},
+	}
+
+	_, err := tcpWorkspace(workspace)
+	if err == nil {
+		t.Errorf("Expected devcontainer builds to be refused")
+	}
+}
@@ -0,0 +1,94 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/daytonaio/daytona-provider-docker/pkg/client"
+	"github.com/daytonaio/daytona-provider-docker/pkg/ssh_tunnel"
+)
+
+// HintedError is an error of the provider with a hint on how to fix it. The hint is part of the message because
+// the errors only reach the Daytona server as strings. It matches its Kind with errors.Is.
+type HintedError struct {
+	// Kind is one of the sentinel errors of the ssh_tunnel and client packages
+	Kind error
+	Err  error
+	Hint string
+}
+
+func (e *HintedError) Error() string {
+	return fmt.Sprintf("%v (hint: %s)", e.Err, e.Hint)
+}
+
+func (e *HintedError) Unwrap() error {
+	return e.Err
+}
+
+func (e *HintedError) Is(target error) bool {
+	return target == e.Kind
+}
+
+// errorHints are checked in order, the first kind the error matches gives the hint
+var errorHints = []struct {
+	kind error
+	hint string
+}{
+	{ssh_tunnel.ErrHostKeyMismatch, "the host key of the remote host changed, if that's expected remove its old key from the known_hosts file"},
+	{ssh_tunnel.ErrHostKeyNotRecorded, "the provider couldn't record the host key for trust on first use, check that its known hosts file (~/.config/daytona/docker-provider/known_hosts) is writable or add the host key to ~/.ssh/known_hosts"},
+	{ssh_tunnel.ErrHostKeyUnknown, "add the host key of the remote host to ~/.ssh/known_hosts (e.g. with ssh-keyscan) or set the Host Key Policy to trust-on-first-use"},
+	{ssh_tunnel.ErrAuthFailed, "check the Remote User, the Auth Method and its credentials, with an ssh-agent set the SSH Agent Socket"},
+	{ssh_tunnel.ErrHostUnreachable, "check the Remote Hostname and Remote Port and that the host accepts SSH connections from the runner"},
+	{client.ErrSockPermissionDenied, "add the user to the docker group (sudo usermod -aG docker <user>) and log in again, or set the Sock Path to a socket the user can access"},
+	{client.ErrSockNotFound, "check that docker is installed and running on the host, or set the Sock Path"},
+	{client.ErrDaemonNotResponding, "start the docker daemon (e.g. sudo systemctl start docker) or set the Sock Path to a socket it listens on"},
+}
+
+// podmanHints replace the hints of errorHints for the errors of Podman sockets
+var podmanHints = map[error]string{
+	client.ErrSockPermissionDenied: "use the rootless Podman socket of the user (systemctl --user enable --now podman.socket), the rootful socket is only accessible to root, or set the Sock Path to a socket the user can access",
+	client.ErrSockNotFound:         "enable the Podman API socket with systemctl enable --now podman.socket (add --user for rootless Podman), or set the Sock Path",
+	client.ErrDaemonNotResponding:  "start the Podman API socket with systemctl start podman.socket (add --user for rootless Podman), or set the Sock Path to a socket it listens on",
+}
+
+// withHint attaches a hint to the errors the user can fix in the target options or on the docker host
+func withHint(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var hintedErr *HintedError
+	if errors.As(err, &hintedErr) {
+		return err
+	}
+
+	for _, errorHint := range errorHints {
+		if errors.Is(err, errorHint.kind) {
+			return &HintedError{Kind: errorHint.kind, Err: err, Hint: hintFor(errorHint.kind, err)}
+		}
+	}
+
+	// The docker client errors don't always keep their cause
+	if kind := client.ClassifyError(err); kind != nil {
+		return &HintedError{Kind: kind, Err: err, Hint: hintFor(kind, err)}
+	}
+
+	return err
+}
+
+// hintFor returns the hint of the kind of error, depending on the engine for socket errors
+func hintFor(kind error, err error) string {
+	var sockErr *client.SockError
+	if errors.As(err, &sockErr) && sockErr.Engine() == client.EnginePodman {
+		if hint, ok := podmanHints[kind]; ok {
+			return hint
+		}
+	}
+
+	for _, errorHint := range errorHints {
+		if errorHint.kind == kind {
+			return errorHint.hint
+		}
+	}
+	return ""
+}
@@ -0,0 +1,55 @@
+package provider
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/daytonaio/daytona-provider-docker/pkg/client"
+)
+
+func TestWithHint(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		kind error
+		hint string
+	}{
+		{
+			name: "docker socket",
+			err:  &client.SockError{Path: "/var/run/docker.sock", Kind: client.ErrSockPermissionDenied},
+			kind: client.ErrSockPermissionDenied,
+			hint: "docker group",
+		},
+		{
+			name: "podman socket",
+			err:  &client.SockError{Path: client.PodmanRootfulSockPath, Kind: client.ErrSockPermissionDenied},
+			kind: client.ErrSockPermissionDenied,
+			hint: "rootless Podman socket",
+		},
+		{
+			name: "podman daemon",
+			err:  &client.SockError{Path: "/run/user/1000/podman/podman.sock", Kind: client.ErrDaemonNotResponding},
+			kind: client.ErrDaemonNotResponding,
+			hint: "podman.socket",
+		},
+		{
+			name: "flattened docker error",
+			err:  errors.New("permission denied while trying to connect to the Docker daemon socket at unix:///var/run/docker.sock"),
+			kind: client.ErrSockPermissionDenied,
+			hint: "docker group",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := withHint(test.err)
+			if !errors.Is(err, test.kind) {
+				t.Errorf("Expected the error to match %v, got %v", test.kind, err)
+			}
+			if !strings.Contains(err.Error(), test.hint) {
+				t.Errorf("Expected the hint to mention %q, got %s", test.hint, err)
+			}
+		})
+	}
+}
@@ -2,18 +2,24 @@ package provider
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/url"
 	"os"
+	"os/exec"
 	"path"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"time"
 
 	internal "github.com/daytonaio/daytona-provider-docker/internal"
 	log_writers "github.com/daytonaio/daytona-provider-docker/internal/log"
 	"github.com/daytonaio/daytona-provider-docker/pkg/client"
+	"github.com/daytonaio/daytona-provider-docker/pkg/docker_context"
+	"github.com/daytonaio/daytona-provider-docker/pkg/ssh_tunnel/util"
 	"github.com/daytonaio/daytona-provider-docker/pkg/types"
 
 	"github.com/daytonaio/daytona/pkg/build/detect"
@@ -25,8 +31,13 @@ import (
 	provider_util "github.com/daytonaio/daytona/pkg/provider/util"
 	"github.com/daytonaio/daytona/pkg/ssh"
 	docker_sdk "github.com/docker/docker/client"
+
+	log "github.com/sirupsen/logrus"
 )
 
+// sockPingTimeout bounds the ping of the Podman sockets in the requirement checks
+const sockPingTimeout = 5 * time.Second
+
 type DockerProvider struct {
 	BasePath           *string
 	DaytonaDownloadUrl *string
@@ -89,12 +100,68 @@ func (p DockerProvider) GetInfo() (models.ProviderInfo, error) {
 }
 
 func (p DockerProvider) GetPresetTargetConfigs() (*[]provider.TargetConfig, error) {
-	return &[]provider.TargetConfig{
+	presets := []provider.TargetConfig{
 		{
 			Name:    "local",
-			Options: "{\n\t\"Sock Path\": \"/var/run/docker.sock\"\n}",
+			Options: fmt.Sprintf("{\n\t\"Schema Version\": %d\n}", types.CurrentSchemaVersion),
 		},
-	}, nil
+	}
+
+	// Offer the Podman sockets that exist
+	for _, podman := range []struct {
+		name     string
+		sockPath string
+	}{
+		{name: "podman", sockPath: client.PodmanRootfulSockPath},
+		{name: "podman-rootless", sockPath: client.PodmanRootlessSockPath()},
+	} {
+		if _, err := os.Stat(podman.sockPath); err != nil {
+			continue
+		}
+
+		presets = append(presets, provider.TargetConfig{
+			Name:    podman.name,
+			Options: fmt.Sprintf("{\n\t\"Schema Version\": %d,\n\t\"Sock Path\": %q\n}", types.CurrentSchemaVersion, podman.sockPath),
+		})
+	}
+
+	// Offer the endpoints managed with `docker context`, the default context is the local preset
+	contexts, err := docker_context.List()
+	if err != nil {
+		log.Warnf("failed to list docker contexts: %v", err)
+		return &presets, nil
+	}
+
+	for _, dockerContext := range contexts {
+		if dockerContext.Name == docker_context.DefaultContextName || hasPreset(presets, dockerContext.Name) {
+			continue
+		}
+
+		schemaVersion := types.CurrentSchemaVersion
+		options, err := json.MarshalIndent(types.TargetConfigOptions{
+			SchemaVersion: &schemaVersion,
+			DockerContext: &dockerContext.Name,
+		}, "", "\t")
+		if err != nil {
+			return nil, err
+		}
+
+		presets = append(presets, provider.TargetConfig{
+			Name:    dockerContext.Name,
+			Options: string(options),
+		})
+	}
+
+	return &presets, nil
+}
+
+func hasPreset(presets []provider.TargetConfig, name string) bool {
+	for _, preset := range presets {
+		if preset.Name == name {
+			return true
+		}
+	}
+	return false
 }
 
 func (p DockerProvider) StartTarget(targetReq *provider.TargetRequest) (*provider_util.Empty, error) {
@@ -116,29 +183,50 @@ func (p DockerProvider) DestroyTarget(targetReq *provider.TargetRequest) (*provi
 		return new(provider_util.Empty), err
 	}
 
-	sshClient, err := p.getSshClient(targetReq.Target.TargetConfig.Options)
+	targetOptions, _, err := types.ParseTargetConfigOptions(targetReq.Target.TargetConfig.Options)
 	if err != nil {
 		return new(provider_util.Empty), err
 	}
-	if sshClient != nil {
-		defer sshClient.Close()
+
+	// Without SSH, the docker client would remove the directory from the runner
+	if targetOptions.IsTcp() {
+		return new(provider_util.Empty), withHint(client.RemoveDaemonDir(*targetOptions, p.RemoteSockDir, targetDir))
 	}
 
-	err = dockerClient.DestroyTarget(targetReq.Target, targetDir, sshClient)
+	sshClient, releaseSshClient, err := p.getSshClient(targetReq.Target.TargetConfig.Options)
 	if err != nil {
 		return new(provider_util.Empty), err
 	}
+	defer releaseSshClient()
+
+	err = dockerClient.DestroyTarget(targetReq.Target, targetDir, sshClient)
+	if err != nil {
+		return new(provider_util.Empty), withHint(err)
+	}
 
 	return new(provider_util.Empty), nil
 }
 
 func (p DockerProvider) GetTargetProviderMetadata(targetReq *provider.TargetRequest) (string, error) {
-	dockerClient, err := p.getClient(targetReq.Target.TargetConfig.Options)
+	targetOptions, _, err := types.ParseTargetConfigOptions(targetReq.Target.TargetConfig.Options)
+	if err != nil {
+		return "", err
+	}
+
+	// Report the socket picked by the discovery
+	sockPath, err := client.SockPath(*targetOptions)
+	if err != nil {
+		return "", withHint(err)
+	}
+
+	metadata, err := json.Marshal(types.TargetMetadata{
+		SockPath: sockPath,
+	})
 	if err != nil {
 		return "", err
 	}
 
-	return dockerClient.GetTargetProviderMetadata(targetReq.Target)
+	return string(metadata), nil
 }
 
 func (p DockerProvider) StartWorkspace(workspaceReq *provider.WorkspaceRequest) (*provider_util.Empty, error) {
@@ -171,11 +259,19 @@ func (p DockerProvider) StartWorkspace(workspaceReq *provider.WorkspaceRequest)
 	downloadUrl := *p.DaytonaDownloadUrl
 	var sshClient *ssh.Client
 
-	_, isLocal, err := types.ParseTargetConfigOptions(workspaceReq.Workspace.Target.TargetConfig.Options)
+	targetOptions, isLocal, err := types.ParseTargetConfigOptions(workspaceReq.Workspace.Target.TargetConfig.Options)
 	if err != nil {
 		return new(provider_util.Empty), err
 	}
 
+	workspace := workspaceReq.Workspace
+	if targetOptions.IsTcp() {
+		workspace, err = tcpWorkspace(workspace)
+		if err != nil {
+			return new(provider_util.Empty), err
+		}
+	}
+
 	if isLocal && workspaceReq.Workspace.Target.TargetConfig.ProviderInfo.RunnerId == common.LOCAL_RUNNER_ID {
 		builderType, err := detect.DetectWorkspaceBuilderType(workspaceReq.Workspace.BuildConfig, workspaceDir, nil)
 		if err != nil {
@@ -188,22 +284,35 @@ func (p DockerProvider) StartWorkspace(workspaceReq *provider.WorkspaceRequest)
 				return new(provider_util.Empty), err
 			}
 
-			parsed.Host = fmt.Sprintf("host.docker.internal:%d", *p.ApiPort)
+			parsed.Host = fmt.Sprintf("%s:%d", p.getHostGatewayName(*targetOptions), *p.ApiPort)
 			parsed.Scheme = "http"
 			downloadUrl = parsed.String()
 		}
 	} else {
-		sshClient, err = p.getSshClient(workspaceReq.Workspace.Target.TargetConfig.Options)
+		var releaseSshClient func()
+		sshClient, releaseSshClient, err = p.getSshClient(workspaceReq.Workspace.Target.TargetConfig.Options)
 		if err != nil {
 			return new(provider_util.Empty), err
 		}
-		if sshClient != nil {
-			defer sshClient.Close()
+		defer releaseSshClient()
+
+		if targetOptions.RemoteHostname != nil && targetOptions.ExposeServerApi != nil && *targetOptions.ExposeServerApi {
+			builderType, err := detect.DetectWorkspaceBuilderType(workspace.BuildConfig, workspaceDir, sshClient)
+			if err != nil {
+				return new(provider_util.Empty), err
+			}
+
+			if builderType != detect.BuilderTypeDevcontainer {
+				downloadUrl, err = p.exposeServerApi(*targetOptions, workspace, downloadUrl)
+				if err != nil {
+					return new(provider_util.Empty), withHint(err)
+				}
+			}
 		}
 	}
 
 	err = dockerClient.StartWorkspace(&docker.CreateWorkspaceOptions{
-		Workspace:           workspaceReq.Workspace,
+		Workspace:           workspace,
 		WorkspaceDir:        workspaceDir,
 		ContainerRegistries: workspaceReq.ContainerRegistries,
 		LogWriter:           logWriter,
@@ -212,7 +321,7 @@ func (p DockerProvider) StartWorkspace(workspaceReq *provider.WorkspaceRequest)
 		BuilderImage:        workspaceReq.BuilderImage,
 	}, downloadUrl)
 	if err != nil {
-		return new(provider_util.Empty), err
+		return new(provider_util.Empty), withHint(err)
 	}
 
 	go func() {
@@ -247,7 +356,7 @@ func (p DockerProvider) StopWorkspace(workspaceReq *provider.WorkspaceRequest) (
 		defer workspaceLogWriter.Close()
 	}
 
-	return new(provider_util.Empty), dockerClient.StopWorkspace(workspaceReq.Workspace, logWriter)
+	return new(provider_util.Empty), withHint(dockerClient.StopWorkspace(workspaceReq.Workspace, logWriter))
 }
 
 func (p DockerProvider) DestroyWorkspace(workspaceReq *provider.WorkspaceRequest) (*provider_util.Empty, error) {
@@ -261,17 +370,31 @@ func (p DockerProvider) DestroyWorkspace(workspaceReq *provider.WorkspaceRequest
 		return new(provider_util.Empty), err
 	}
 
-	sshClient, err := p.getSshClient(workspaceReq.Workspace.Target.TargetConfig.Options)
+	targetOptions, _, err := types.ParseTargetConfigOptions(workspaceReq.Workspace.Target.TargetConfig.Options)
 	if err != nil {
 		return new(provider_util.Empty), err
 	}
-	if sshClient != nil {
-		defer sshClient.Close()
+
+	if targetOptions.IsTcp() {
+		// Without SSH, the docker client would remove the directory from the runner. It skips removing an empty path
+		// and only removes the container.
+		err = dockerClient.DestroyWorkspace(workspaceReq.Workspace, "", nil)
+		if err != nil {
+			return new(provider_util.Empty), withHint(err)
+		}
+
+		return new(provider_util.Empty), withHint(client.RemoveDaemonDir(*targetOptions, p.RemoteSockDir, workspaceDir))
+	}
+
+	sshClient, releaseSshClient, err := p.getSshClient(workspaceReq.Workspace.Target.TargetConfig.Options)
+	if err != nil {
+		return new(provider_util.Empty), err
 	}
+	defer releaseSshClient()
 
 	err = dockerClient.DestroyWorkspace(workspaceReq.Workspace, workspaceDir, sshClient)
 	if err != nil {
-		return new(provider_util.Empty), err
+		return new(provider_util.Empty), withHint(err)
 	}
 
 	return new(provider_util.Empty), nil
@@ -283,7 +406,8 @@ func (p DockerProvider) GetWorkspaceProviderMetadata(workspaceReq *provider.Work
 		return "", err
 	}
 
-	return dockerClient.GetWorkspaceProviderMetadata(workspaceReq.Workspace)
+	metadata, err := dockerClient.GetWorkspaceProviderMetadata(workspaceReq.Workspace)
+	return metadata, withHint(err)
 }
 
 func (p DockerProvider) getClient(targetOptionsJson string) (docker.IDockerClient, error) {
@@ -292,16 +416,60 @@ func (p DockerProvider) getClient(targetOptionsJson string) (docker.IDockerClien
 		return nil, err
 	}
 
-	client, err := client.GetClient(*targetOptions, p.RemoteSockDir)
+	cli, err := client.GetClient(*targetOptions, p.RemoteSockDir)
 	if err != nil {
-		return nil, err
+		return nil, withHint(err)
 	}
 
 	return docker.NewDockerClient(docker.DockerClientConfig{
-		ApiClient: client,
+		ApiClient: client.WithEngine(cli, client.TargetEngine(*targetOptions, p.RemoteSockDir)),
 	}), nil
 }
 
+// exposeServerApi makes the server API reachable from the workspace through a reverse tunnel to the remote host
+// and returns the download url rewritten to use it
+func (p DockerProvider) exposeServerApi(targetOptions types.TargetConfigOptions, workspace *models.Workspace, downloadUrl string) (string, error) {
+	cli, err := client.GetClient(targetOptions, p.RemoteSockDir)
+	if err != nil {
+		return "", err
+	}
+	defer cli.Close()
+
+	engine := client.TargetEngine(targetOptions, p.RemoteSockDir)
+
+	err = client.ExposeLocalPort(targetOptions, client.ReverseTunnelBindAddress(cli, engine), int(*p.ApiPort))
+	if err != nil {
+		return "", err
+	}
+
+	parsed, err := url.Parse(downloadUrl)
+	if err != nil {
+		return "", err
+	}
+
+	hostGatewayName := engine.HostGatewayName()
+
+	parsed.Host = fmt.Sprintf("%s:%d", hostGatewayName, *p.ApiPort)
+	parsed.Scheme = "http"
+
+	setExposedServerApiUrl(workspace, hostGatewayName, *p.ApiPort)
+
+	return parsed.String(), nil
+}
+
+func setExposedServerApiUrl(workspace *models.Workspace, hostGatewayName string, apiPort uint32) {
+	if workspace.EnvVars == nil {
+		workspace.EnvVars = map[string]string{}
+	}
+	workspace.EnvVars["DAYTONA_SERVER_API_URL"] = fmt.Sprintf("http://%s:%d", hostGatewayName, apiPort)
+}
+
+// getHostGatewayName returns the hostname the workspace containers of the target use to reach their host, which
+// depends on whether the target runs Docker or Podman
+func (p DockerProvider) getHostGatewayName(targetOptions types.TargetConfigOptions) string {
+	return client.TargetEngine(targetOptions, p.RemoteSockDir).HostGatewayName()
+}
+
 func (p DockerProvider) CheckRequirements() (*[]provider.RequirementStatus, error) {
 	var results []provider.RequirementStatus
 	ctx := context.Background()
@@ -313,6 +481,7 @@ func (p DockerProvider) CheckRequirements() (*[]provider.RequirementStatus, erro
 			Met:    false,
 			Reason: "Docker is not installed",
 		})
+		results = append(results, checkPodmanRequirements()...)
 		return &results, nil
 	} else {
 		results = append(results, provider.RequirementStatus{
@@ -328,7 +497,7 @@ func (p DockerProvider) CheckRequirements() (*[]provider.RequirementStatus, erro
 		results = append(results, provider.RequirementStatus{
 			Name:   "Docker running",
 			Met:    false,
-			Reason: "Docker is not running. Error: " + err.Error(),
+			Reason: "Docker is not running. Error: " + withHint(err).Error(),
 		})
 	} else {
 		results = append(results, provider.RequirementStatus{
@@ -337,9 +506,55 @@ func (p DockerProvider) CheckRequirements() (*[]provider.RequirementStatus, erro
 			Reason: "Docker is running",
 		})
 	}
+
+	results = append(results, checkPodmanRequirements()...)
 	return &results, nil
 }
 
+// checkPodmanRequirements checks the rootful and rootless Podman API sockets if Podman is installed. Podman is
+// running if either socket answers.
+func checkPodmanRequirements() []provider.RequirementStatus {
+	_, err := exec.LookPath("podman")
+	if err != nil {
+		return nil
+	}
+
+	var failures []string
+	for _, sockPath := range []string{client.PodmanRootfulSockPath, client.PodmanRootlessSockPath()} {
+		err := pingSock(sockPath)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", sockPath, err.Error()))
+			continue
+		}
+
+		return []provider.RequirementStatus{{
+			Name:   "Podman running",
+			Met:    true,
+			Reason: fmt.Sprintf("Podman is running at %s", sockPath),
+		}}
+	}
+
+	return []provider.RequirementStatus{{
+		Name:   "Podman running",
+		Met:    false,
+		Reason: fmt.Sprintf("Podman is not serving its API. Enable podman.socket, with --user for rootless Podman, to use it. Errors: %s", strings.Join(failures, "; ")),
+	}}
+}
+
+func pingSock(sockPath string) error {
+	cli, err := docker_sdk.NewClientWithOpts(docker_sdk.WithHost("unix://"+sockPath), docker_sdk.WithAPIVersionNegotiation())
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), sockPingTimeout)
+	defer cancel()
+
+	_, err = cli.Ping(ctx)
+	return err
+}
+
 func (p *DockerProvider) getWorkspaceDir(workspaceReq *provider.WorkspaceRequest) (string, error) {
 	targetOptions, isLocal, err := types.ParseTargetConfigOptions(workspaceReq.Workspace.Target.TargetConfig.Options)
 	if err != nil {
@@ -368,21 +583,22 @@ func (p *DockerProvider) getTargetDir(targetReq *provider.TargetRequest) (string
 	return path.Join(*targetOptions.TargetDataDir, targetReq.Target.Id), nil
 }
 
-func (p *DockerProvider) getSshClient(targetOptionsJson string) (*ssh.Client, error) {
+// getSshClient returns a pooled SSH connection to the remote host of the target, or nil if it isn't reached over SSH.
+// The returned release function must be called instead of closing the client.
+func (p *DockerProvider) getSshClient(targetOptionsJson string) (*ssh.Client, func(), error) {
 	targetOptions, isLocal, err := types.ParseTargetConfigOptions(targetOptionsJson)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	if isLocal {
-		return nil, nil
+	if isLocal || targetOptions.IsTcp() {
+		return nil, func() {}, nil
 	}
 
-	return ssh.NewClient(&ssh.SessionConfig{
-		Hostname:       *targetOptions.RemoteHostname,
-		Port:           *targetOptions.RemotePort,
-		Username:       *targetOptions.RemoteUser,
-		Password:       targetOptions.RemotePassword,
-		PrivateKeyPath: targetOptions.RemotePrivateKey,
-	})
+	sshClient, release, err := util.GetRemoteClient(*targetOptions)
+	if err != nil {
+		return nil, nil, withHint(err)
+	}
+
+	return &ssh.Client{Client: sshClient}, release, nil
 }
@@ -0,0 +1,219 @@
+// Copyright 2024 Daytona Platforms Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package ssh_tunnel
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// SetAgentSocket sets the socket of the ssh-agent (defaults to the SSH_AUTH_SOCK environment variable).
+func (tun *SshTunnel) SetAgentSocket(socket string) {
+	tun.agentSock = socket
+}
+
+// SetAgentIdentities restricts the keys of the ssh-agent to the ones matching one of the identities, either a
+// SHA256 fingerprint or a key comment. All the keys are used if none is set.
+func (tun *SshTunnel) SetAgentIdentities(identities ...string) {
+	tun.agentIdentities = identities
+}
+
+func (tun *SshTunnel) agentSocket() string {
+	if tun.agentSock != "" {
+		return tun.agentSock
+	}
+	return os.Getenv("SSH_AUTH_SOCK")
+}
+
+// getSSHServerSigners returns the signers of the ssh-agent matching the agent identities of the tunnel. The
+// descriptions of the keys that are returned are kept to explain authentication failures.
+func (tun *SshTunnel) getSSHServerSigners() ([]ssh.Signer, error) {
+	socket := tun.agentSocket()
+	if socket == "" {
+		return nil, errors.New("no ssh-agent socket, SSH_AUTH_SOCK is not set and no agent socket is configured")
+	}
+
+	agentClient, err := tun.agentClient(socket)
+	if err != nil {
+		return nil, err
+	}
+
+	agentKeys, err := agentClient.List()
+	if err != nil {
+		// The agent may have been restarted, the next attempt connects again
+		tun.closeAgent()
+		return nil, fmt.Errorf("listing the keys of the ssh-agent at %s: %w", socket, err)
+	}
+
+	signers, err := agentClient.Signers()
+	if err != nil {
+		tun.closeAgent()
+		return nil, fmt.Errorf("getting the signers of the ssh-agent at %s: %w", socket, err)
+	}
+
+	var matching []ssh.Signer
+	names := map[string]string{}
+	for _, signer := range signers {
+		key := findAgentKey(agentKeys, signer.PublicKey())
+		if key == nil || !agentKeyMatches(key, tun.agentIdentities) {
+			continue
+		}
+		matching = append(matching, signer)
+		names[ssh.FingerprintSHA256(key)] = describeAgentKey(key)
+	}
+
+	if len(tun.agentIdentities) > 0 && len(matching) == 0 {
+		return nil, fmt.Errorf("no key of the ssh-agent at %s matches %s, it holds %s", socket,
+			strings.Join(tun.agentIdentities, ", "), describeAgentKeys(agentKeys))
+	}
+
+	tun.agentMutex.Lock()
+	tun.agentKeyNames = names
+	tun.agentMutex.Unlock()
+
+	return matching, nil
+}
+
+// agentClient returns the client of the ssh-agent at socket, connecting to it the first time. The signers of the
+// SSH config use the connection for every handshake, so it's kept until the tunnel is stopped.
+func (tun *SshTunnel) agentClient(socket string) (agent.ExtendedAgent, error) {
+	tun.agentMutex.Lock()
+	defer tun.agentMutex.Unlock()
+
+	if tun.agentConn != nil && tun.agentConnSock == socket {
+		return tun.agent, nil
+	}
+	if tun.agentConn != nil {
+		tun.agentConn.Close()
+		tun.agentConn = nil
+	}
+
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("opening ssh-agent socket %s: %w", socket, err)
+	}
+
+	tun.agentConn = conn
+	tun.agentConnSock = socket
+	tun.agent = agent.NewClient(conn)
+
+	return tun.agent, nil
+}
+
+// closeAgent closes the connection to the ssh-agent of the tunnel and of its jump hosts
+func (tun *SshTunnel) closeAgent() {
+	tun.agentMutex.Lock()
+	if tun.agentConn != nil {
+		tun.agentConn.Close()
+		tun.agentConn = nil
+		tun.agent = nil
+	}
+	tun.agentMutex.Unlock()
+
+	for _, jumpHost := range tun.jumpHosts {
+		jumpHost.closeAgent()
+	}
+}
+
+// resetAgentOffered forgets the keys of the ssh-agent offered to the server, it's called before every handshake
+func (tun *SshTunnel) resetAgentOffered() {
+	tun.agentMutex.Lock()
+	tun.agentOffered = nil
+	tun.agentMutex.Unlock()
+}
+
+// agentKeyOffered records that a key of the ssh-agent was offered to the server during the current handshake
+func (tun *SshTunnel) agentKeyOffered(publicKey ssh.PublicKey) {
+	tun.agentMutex.Lock()
+	defer tun.agentMutex.Unlock()
+
+	name, ok := tun.agentKeyNames[ssh.FingerprintSHA256(publicKey)]
+	if cert, isCert := publicKey.(*ssh.Certificate); !ok && isCert {
+		// The certificate was read from a file, the agent only holds its key
+		name, ok = tun.agentKeyNames[ssh.FingerprintSHA256(cert.Key)]
+	}
+	if ok {
+		tun.agentOffered = append(tun.agentOffered, name)
+	}
+}
+
+// withAgentDetails adds the ssh-agent and the keys it offered during the last handshake to authentication failures
+func (tun *SshTunnel) withAgentDetails(err error) error {
+	tun.agentMutex.Lock()
+	offered := strings.Join(tun.agentOffered, ", ")
+	tun.agentMutex.Unlock()
+
+	if offered == "" || !strings.Contains(err.Error(), "unable to authenticate") {
+		return err
+	}
+
+	return fmt.Errorf("%w (the ssh-agent at %s offered %s)", err, tun.agentSocket(), offered)
+}
+
+func findAgentKey(agentKeys []*agent.Key, publicKey ssh.PublicKey) *agent.Key {
+	for _, key := range agentKeys {
+		if bytes.Equal(key.Blob, publicKey.Marshal()) {
+			return key
+		}
+	}
+	return nil
+}
+
+// agentKeyMatches checks the key against the SHA256 fingerprints, with or without the `SHA256:` prefix, and the
+// comments. Certificates also match the fingerprint of their key.
+func agentKeyMatches(key *agent.Key, identities []string) bool {
+	if len(identities) == 0 {
+		return true
+	}
+
+	fingerprints := []string{ssh.FingerprintSHA256(key)}
+	if publicKey, err := ssh.ParsePublicKey(key.Blob); err == nil {
+		if cert, ok := publicKey.(*ssh.Certificate); ok {
+			fingerprints = append(fingerprints, ssh.FingerprintSHA256(cert.Key))
+		}
+	}
+
+	for _, identity := range identities {
+		identity = strings.TrimSpace(identity)
+		if identity == "" {
+			continue
+		}
+		if identity == key.Comment {
+			return true
+		}
+		for _, fingerprint := range fingerprints {
+			if identity == fingerprint || "SHA256:"+identity == fingerprint {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func describeAgentKey(key *agent.Key) string {
+	if key.Comment == "" {
+		return ssh.FingerprintSHA256(key)
+	}
+	return fmt.Sprintf("%s (%s)", ssh.FingerprintSHA256(key), key.Comment)
+}
+
+func describeAgentKeys(agentKeys []*agent.Key) string {
+	if len(agentKeys) == 0 {
+		return "no keys"
+	}
+
+	descriptions := make([]string, 0, len(agentKeys))
+	for _, key := range agentKeys {
+		descriptions = append(descriptions, describeAgentKey(key))
+	}
+	return strings.Join(descriptions, ", ")
+}
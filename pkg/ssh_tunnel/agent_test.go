@@ -0,0 +1,181 @@
+package ssh_tunnel
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// newTestAgent serves an ssh-agent holding a key for each comment. It returns the socket, the fingerprints of the
+// keys by comment and the number of connections the agent accepted.
+func newTestAgent(t *testing.T, comments ...string) (string, map[string]string, *atomic.Int32) {
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		listener.Close()
+	})
+
+	keyring := agent.NewKeyring()
+	fingerprints := map[string]string{}
+	for _, comment := range comments {
+		_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = keyring.Add(agent.AddedKey{PrivateKey: privateKey, Comment: comment})
+		if err != nil {
+			t.Fatal(err)
+		}
+		signer, err := ssh.NewSignerFromKey(privateKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fingerprints[comment] = ssh.FingerprintSHA256(signer.PublicKey())
+	}
+
+	accepted := &atomic.Int32{}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			accepted.Add(1)
+			go agent.ServeAgent(keyring, conn)
+		}
+	}()
+
+	return socket, fingerprints, accepted
+}
+
+func TestGetSSHServerSigners(t *testing.T) {
+	socket, fingerprints, _ := newTestAgent(t, "alice@laptop", "deploy")
+
+	tests := []struct {
+		name       string
+		identities []string
+		expected   []string
+		err        string
+	}{
+		{name: "all keys", expected: []string{"alice@laptop", "deploy"}},
+		{name: "comment", identities: []string{"deploy"}, expected: []string{"deploy"}},
+		{name: "fingerprint", identities: []string{fingerprints["alice@laptop"]}, expected: []string{"alice@laptop"}},
+		{name: "fingerprint without prefix", identities: []string{strings.TrimPrefix(fingerprints["deploy"], "SHA256:")}, expected: []string{"deploy"}},
+		{name: "no match", identities: []string{"bob@desktop"}, err: "it holds"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tun := NewDialer("docker.example.com")
+			tun.SetAgentSocket(socket)
+			tun.SetAgentIdentities(test.identities...)
+
+			signers, err := tun.getSSHServerSigners()
+			if test.err != "" {
+				if err == nil {
+					t.Fatalf("Expected an error, got %d signers", len(signers))
+				}
+				for _, expected := range []string{socket, test.err, fingerprints["alice@laptop"], "deploy"} {
+					if !strings.Contains(err.Error(), expected) {
+						t.Errorf("Expected the error to contain %q, got %s", expected, err)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(signers) != len(test.expected) {
+				t.Fatalf("Expected %d signers, got %d", len(test.expected), len(signers))
+			}
+			for i, comment := range test.expected {
+				if ssh.FingerprintSHA256(signers[i].PublicKey()) != fingerprints[comment] {
+					t.Errorf("Expected the key of %s", comment)
+				}
+				if !strings.Contains(tun.agentKeyNames[fingerprints[comment]], comment) {
+					t.Errorf("Expected the description of %s to be kept, got %v", comment, tun.agentKeyNames)
+				}
+			}
+		})
+	}
+}
+
+func TestAgentConnection(t *testing.T) {
+	socket, _, accepted := newTestAgent(t, "deploy")
+
+	tun := NewDialer("docker.example.com")
+	tun.SetAgentSocket(socket)
+
+	// The SSH config is initialized again on every start of the tunnel
+	for i := 0; i < 3; i++ {
+		_, err := tun.getSSHServerSigners()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if accepted.Load() != 1 {
+		t.Errorf("Expected a single connection to the agent, got %d", accepted.Load())
+	}
+
+	agentClient := tun.agent
+	tun.Stop()
+
+	if tun.agentConn != nil {
+		t.Errorf("Expected Stop to close the connection to the agent")
+	}
+	if _, err := agentClient.List(); err == nil {
+		t.Errorf("Expected the closed connection to fail")
+	}
+
+	_, err := tun.getSSHServerSigners()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if accepted.Load() != 2 {
+		t.Errorf("Expected the agent to be connected to again, got %d connections", accepted.Load())
+	}
+}
+
+func TestAgentOfferedPerHandshake(t *testing.T) {
+	server := newTestServer(t)
+	socket, fingerprints, _ := newTestAgent(t, "deploy")
+
+	tun := NewDialer("127.0.0.1")
+	tun.SetPort(server.port())
+	tun.SetSSHServer()
+	tun.SetAgentSocket(socket)
+	tun.SetExclusiveAuth(true)
+	tun.SetHostKeyPolicy(HostKeyPolicyInsecure)
+
+	// The signers are read once for the SSH config, the offered keys are recorded again for every handshake
+	for i := 0; i < 3; i++ {
+		_, err := tun.dialVia(nil)
+		if err == nil {
+			t.Fatal("Expected the server to reject the key")
+		}
+		if strings.Count(err.Error(), fingerprints["deploy"]) != 1 {
+			t.Errorf("Expected the key to be reported once, got %s", err)
+		}
+	}
+
+	// A server that doesn't accept public keys isn't offered the key of the agent
+	server.passwordOnly.Store(true)
+	_, err := tun.dialVia(nil)
+	if err == nil {
+		t.Fatal("Expected the server to reject the client")
+	}
+	if strings.Contains(err.Error(), fingerprints["deploy"]) {
+		t.Errorf("Expected the key not to be reported as offered, got %s", err)
+	}
+}
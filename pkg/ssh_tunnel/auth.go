@@ -4,14 +4,15 @@
 package ssh_tunnel
 
 import (
+	"bytes"
 	"fmt"
 	"io"
-	"net"
 	"os"
 	"os/user"
+	"strings"
+	"time"
 
 	"golang.org/x/crypto/ssh"
-	"golang.org/x/crypto/ssh/agent"
 )
 
 var defaultSSHKeys = []string{"id_rsa", "id_dsa", "id_ecdsa", "id_ecdsa_sk", "id_ed25519", "id_ed25519_sk"}
@@ -35,40 +36,100 @@ const (
 	// AuthTypeAuto tries to get the authentication method automatically. See SSHTun.Start for details on
 	// this.
 	AuthTypeAuto
+	// AuthTypeCertificate uses an OpenSSH user certificate together with its private key, or the certificates
+	// held by the ssh-server.
+	AuthTypeCertificate
+	// AuthTypeKeyboardInteractive answers the prompts of the server with a KeyboardInteractiveResponder.
+	AuthTypeKeyboardInteractive
 )
 
-func (tun *SshTunnel) getSSHAuthMethod() (ssh.AuthMethod, error) {
+// authKey is a key offered for publickey authentication together with where it was loaded from.
+type authKey struct {
+	signer ssh.Signer
+	source string
+}
+
+// getSSHAuthMethods returns the authentication methods in the order they are tried against the server, like
+// OpenSSH does: the keys (from files, then from the ssh-server), then the password, then keyboard-interactive.
+// With password authentication no keys are offered, so they don't use up the MaxAuthTries of the server.
+func (tun *SshTunnel) getSSHAuthMethods() ([]ssh.AuthMethod, error) {
+	keys, err := tun.getAuthKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	var methods []ssh.AuthMethod
+	if len(keys) > 0 {
+		for _, key := range keys {
+			tun.keyFingerprints = append(tun.keyFingerprints, ssh.FingerprintSHA256(key.signer.PublicKey()))
+		}
+		// The client doesn't retry a method once it failed, so all keys have to be offered by a single method
+		methods = append(methods, tun.publicKeysAuthMethod(keys))
+	}
+
+	if tun.authType == AuthTypePassword {
+		methods = append(methods, tun.passwordAuthMethod())
+	}
+
+	if tun.authType == AuthTypePassword || tun.kbdResponder != nil {
+		methods = append(methods, tun.keyboardInteractiveAuthMethod())
+	}
+
+	return methods, nil
+}
+
+func (tun *SshTunnel) getAuthKeys() ([]authKey, error) {
 	switch tun.authType {
 	case AuthTypeKeyFile:
-		return tun.getSSHAuthMethodForKeyFile(false)
+		keys, err := tun.getKeysForKeyFile(false)
+		if err != nil {
+			return nil, err
+		}
+		return tun.withSSHServerKeys(keys), nil
 	case AuthTypeEncryptedKeyFile:
-		return tun.getSSHAuthMethodForKeyFile(true)
+		keys, err := tun.getKeysForKeyFile(true)
+		if err != nil {
+			return nil, err
+		}
+		return tun.withSSHServerKeys(keys), nil
 	case AuthTypeKeyReader:
-		return tun.getSSHAuthMethodForKeyReader(false)
+		return tun.getKeysForKeyReader(false)
 	case AuthTypeEncryptedKeyReader:
-		return tun.getSSHAuthMethodForKeyReader(true)
+		return tun.getKeysForKeyReader(true)
 	case AuthTypePassword:
-		return ssh.Password(tun.authPassword), nil
+		return nil, nil
+	case AuthTypeKeyboardInteractive:
+		if tun.exclusiveAuth {
+			return nil, nil
+		}
+		// Keys are optional, they're offered before keyboard-interactive
+		keys, _ := tun.getKeysForKeyFile(false)
+		return tun.withSSHServerKeys(keys), nil
 	case AuthTypeSSHServer:
-		return tun.getSSHAuthMethodForSSHServer()
+		return tun.getKeysForSSHServer()
+	case AuthTypeCertificate:
+		return tun.getKeysForCertificate()
 	case AuthTypeAuto:
-		method, errFile := tun.getSSHAuthMethodForKeyFile(false)
-		if errFile == nil {
-			return method, nil
+		fileKeys, errFile := tun.getKeysForKeyFile(false)
+		serverKeys, errServer := tun.getKeysForSSHServer()
+		keys := appendNewKeys(fileKeys, serverKeys)
+		if len(keys) == 0 {
+			return nil, fmt.Errorf("auto auth failed (file based: %v) (ssh-server: %v)", errFile, errServer)
 		}
-		method, errServer := tun.getSSHAuthMethodForSSHServer()
-		if errServer == nil {
-			return method, nil
-		}
-		return nil, fmt.Errorf("auto auth failed (file based: %v) (ssh-server: %v)", errFile, errServer)
+		return keys, nil
 	default:
 		return nil, fmt.Errorf("unknown auth type: %d", tun.authType)
 	}
 }
 
-func (tun *SshTunnel) getSSHAuthMethodForKeyFile(encrypted bool) (ssh.AuthMethod, error) {
+// getKeysForKeyFile reads the key file of the tunnel or, if none is set, every default key that can be read.
+func (tun *SshTunnel) getKeysForKeyFile(encrypted bool) ([]authKey, error) {
 	if tun.authKeyFile != "" {
-		return tun.readPrivateKey(tun.authKeyFile, encrypted)
+		key, err := tun.readPrivateKey(tun.authKeyFile, encrypted)
+		if err != nil {
+			return nil, err
+		}
+		return []authKey{{signer: key, source: tun.authKeyFile}}, nil
 	}
 
 	homeDir := "/root"
@@ -77,24 +138,29 @@ func (tun *SshTunnel) getSSHAuthMethodForKeyFile(encrypted bool) (ssh.AuthMethod
 		homeDir = usr.HomeDir
 	}
 
+	var keys []authKey
 	for _, keyName := range defaultSSHKeys {
 		keyFile := fmt.Sprintf("%s/.ssh/%s", homeDir, keyName)
-		authMethod, err := tun.readPrivateKey(keyFile, encrypted)
+		key, err := tun.readPrivateKey(keyFile, encrypted)
 		if err == nil {
-			return authMethod, nil
+			keys = append(keys, authKey{signer: key, source: keyFile})
 		}
 	}
 
-	return nil, fmt.Errorf("could not read any default SSH key (%v)", defaultSSHKeys)
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("could not read any default SSH key (%v)", defaultSSHKeys)
+	}
+
+	return keys, nil
 }
 
-func (tun *SshTunnel) readPrivateKey(keyFile string, encrypted bool) (ssh.AuthMethod, error) {
+func (tun *SshTunnel) readPrivateKey(keyFile string, encrypted bool) (ssh.Signer, error) {
 	buf, err := os.ReadFile(keyFile)
 	if err != nil {
 		return nil, fmt.Errorf("reading SSH key file %s: %w", keyFile, err)
 	}
 
-	key, err := tun.parsePrivateKey(buf, encrypted)
+	key, err := tun.parseSigner(buf, encrypted)
 	if err != nil {
 		return nil, fmt.Errorf("parsing SSH key file %s: %w", keyFile, err)
 	}
@@ -102,51 +168,221 @@ func (tun *SshTunnel) readPrivateKey(keyFile string, encrypted bool) (ssh.AuthMe
 	return key, nil
 }
 
-func (tun *SshTunnel) getSSHAuthMethodForKeyReader(encrypted bool) (ssh.AuthMethod, error) {
+func (tun *SshTunnel) getKeysForKeyReader(encrypted bool) ([]authKey, error) {
+	// The SSH config is initialized again when the tunnel restarts, rewind the reader if it can be
+	if seeker, ok := tun.authKeyReader.(io.Seeker); ok {
+		_, err := seeker.Seek(0, io.SeekStart)
+		if err != nil {
+			return nil, fmt.Errorf("reading from SSH key reader: %w", err)
+		}
+	}
+
 	buf, err := io.ReadAll(tun.authKeyReader)
 	if err != nil {
 		return nil, fmt.Errorf("reading from SSH key reader: %w", err)
 	}
-	key, err := tun.parsePrivateKey(buf, encrypted)
+	key, err := tun.parseSigner(buf, encrypted)
 	if err != nil {
 		return nil, fmt.Errorf("reading from SSH key reader: %w", err)
 	}
-	return key, nil
+	return []authKey{{signer: key, source: "key reader"}}, nil
 }
 
-func (tun *SshTunnel) parsePrivateKey(buf []byte, encrypted bool) (ssh.AuthMethod, error) {
-	var key ssh.Signer
-	var err error
+func (tun *SshTunnel) parseSigner(buf []byte, encrypted bool) (ssh.Signer, error) {
 	if encrypted {
-		key, err = ssh.ParsePrivateKeyWithPassphrase(buf, []byte(tun.authPassword))
+		key, err := ssh.ParsePrivateKeyWithPassphrase(buf, []byte(tun.authPassword))
 		if err != nil {
 			return nil, fmt.Errorf("parsing encrypted key: %w", err)
 		}
-	} else {
-		key, err = ssh.ParsePrivateKey(buf)
-		if err != nil {
-			return nil, fmt.Errorf("error parsing key: %w", err)
-		}
+		return key, nil
 	}
-	return ssh.PublicKeys(key), nil
+
+	key, err := ssh.ParsePrivateKey(buf)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing key: %w", err)
+	}
+	return key, nil
 }
 
-func (tun *SshTunnel) getSSHAuthMethodForSSHServer() (ssh.AuthMethod, error) {
-	conn, err := net.Dial("unix", os.Getenv("SSH_AUTH_SOCK"))
+func (tun *SshTunnel) getKeysForSSHServer() ([]authKey, error) {
+	signers, err := tun.getSSHServerSigners()
 	if err != nil {
-		return nil, fmt.Errorf("opening unix socket: %w", err)
+		return nil, err
+	}
+
+	var keys []authKey
+	for _, signer := range signers {
+		// Expired certificates would be rejected by the server and count against its MaxAuthTries
+		if cert, ok := signer.PublicKey().(*ssh.Certificate); ok && checkCertificate(cert, time.Now()) != nil {
+			continue
+		}
+		keys = append(keys, authKey{signer: signer, source: "ssh-server"})
 	}
 
-	serverClient := agent.NewClient(conn)
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no usable keys in the ssh-agent at %s (use 'ssh-add' to add keys to it)", tun.agentSocket())
+	}
+
+	return keys, nil
+}
+
+// withSSHServerKeys adds the keys of the ssh-server after the given keys, unless only the configured identities
+// may be used.
+func (tun *SshTunnel) withSSHServerKeys(keys []authKey) []authKey {
+	if tun.identitiesOnly || tun.exclusiveAuth {
+		return keys
+	}
 
-	signers, err := serverClient.Signers()
+	serverKeys, err := tun.getKeysForSSHServer()
 	if err != nil {
-		return nil, fmt.Errorf("getting ssh-server signers: %w", err)
+		return keys
 	}
 
-	if len(signers) == 0 {
-		return nil, fmt.Errorf("no signers from ssh-server (use 'ssh-add' to add keys to server)")
+	return appendNewKeys(keys, serverKeys)
+}
+
+// appendNewKeys appends the keys that are not in the list yet, ssh-servers usually hold the default keys too.
+func appendNewKeys(keys []authKey, newKeys []authKey) []authKey {
+	for _, newKey := range newKeys {
+		duplicate := false
+		for _, key := range keys {
+			if bytes.Equal(key.signer.PublicKey().Marshal(), newKey.signer.PublicKey().Marshal()) {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			keys = append(keys, newKey)
+		}
 	}
+	return keys
+}
 
-	return ssh.PublicKeys(signers...), nil
+func (tun *SshTunnel) publicKeysAuthMethod(keys []authKey) ssh.AuthMethod {
+	return ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+		signers := make([]ssh.Signer, 0, len(keys))
+		for _, key := range keys {
+			signers = append(signers, tun.attemptSigner(key))
+		}
+		return signers, nil
+	})
+}
+
+// attemptSigner reports the key as an authentication attempt when the client offers it to the server. The client
+// asks the signer for its public key a few times per offer, only the first call counts.
+type attemptSigner struct {
+	ssh.AlgorithmSigner
+	attempt func()
+	offered bool
+}
+
+func (s *attemptSigner) PublicKey() ssh.PublicKey {
+	if !s.offered {
+		s.offered = true
+		s.attempt()
+	}
+	return s.AlgorithmSigner.PublicKey()
+}
+
+// attemptMultiSigner keeps the algorithms of signers restricted to some of them, e.g. certificates
+type attemptMultiSigner struct {
+	*attemptSigner
+	algorithms []string
+}
+
+func (s *attemptMultiSigner) Algorithms() []string {
+	return s.algorithms
+}
+
+// attemptSigner wraps the key so it's reported when it's offered. The signers are wrapped every time the client
+// asks for them, once per handshake.
+func (tun *SshTunnel) attemptSigner(key authKey) ssh.Signer {
+	attempt := func() {
+		if key.source == "ssh-server" {
+			tun.agentKeyOffered(key.signer.PublicKey())
+		}
+		tun.authAttempt(fmt.Sprintf("publickey %s %s from %s", key.signer.PublicKey().Type(),
+			ssh.FingerprintSHA256(key.signer.PublicKey()), key.source))
+	}
+
+	switch signer := key.signer.(type) {
+	case ssh.MultiAlgorithmSigner:
+		return &attemptMultiSigner{
+			attemptSigner: &attemptSigner{AlgorithmSigner: signer, attempt: attempt},
+			algorithms:    signer.Algorithms(),
+		}
+	case ssh.AlgorithmSigner:
+		return &attemptSigner{AlgorithmSigner: signer, attempt: attempt}
+	default:
+		// Wrapping would hide the algorithms the key supports
+		attempt()
+		return key.signer
+	}
+}
+
+func (tun *SshTunnel) passwordAuthMethod() ssh.AuthMethod {
+	return ssh.PasswordCallback(func() (string, error) {
+		tun.authAttempt("password")
+		return tun.authPassword, nil
+	})
+}
+
+// keyboardInteractiveAuthMethod answers the prompts asking for the password with the password and the other
+// prompts with the responder. Without a responder, all the prompts that don't echo the answer get the password.
+func (tun *SshTunnel) keyboardInteractiveAuthMethod() ssh.AuthMethod {
+	return ssh.KeyboardInteractive(func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+		// Servers may send several rounds of prompts, e.g. the password and then a one-time code
+		if !strings.HasPrefix(tun.lastAuthAttempt, "keyboard-interactive") {
+			tun.authAttempt("keyboard-interactive")
+		}
+
+		answers := make([]string, len(questions))
+		for i, question := range questions {
+			if tun.authType == AuthTypePassword && (tun.kbdResponder == nil || isPasswordPrompt(question)) {
+				if !echos[i] {
+					answers[i] = tun.authPassword
+				}
+				continue
+			}
+			if tun.kbdResponder == nil {
+				continue
+			}
+
+			answer, err := tun.kbdResponder(instruction, question, echos[i])
+			if err != nil {
+				return nil, err
+			}
+			answers[i] = answer
+		}
+		return answers, nil
+	})
+}
+
+// authAttempt reports an authentication attempt. When the client moves on to another key or method, the previous
+// attempt failed.
+func (tun *SshTunnel) authAttempt(method string) {
+	tun.authResult(false)
+
+	tun.lastAuthAttempt = method
+	tun.tunneledState(&TunneledConnectionState{
+		From: tun.Server.String(),
+		Info: fmt.Sprintf("trying %s authentication as %s", method, tun.user),
+	})
+}
+
+// authResult reports the result of the last authentication attempt of the handshake
+func (tun *SshTunnel) authResult(succeeded bool) {
+	if tun.lastAuthAttempt == "" {
+		return
+	}
+
+	result := "failed"
+	if succeeded {
+		result = "succeeded"
+	}
+	tun.tunneledState(&TunneledConnectionState{
+		From: tun.Server.String(),
+		Info: fmt.Sprintf("%s authentication as %s %s", tun.lastAuthAttempt, tun.user, result),
+	})
+	tun.lastAuthAttempt = ""
 }
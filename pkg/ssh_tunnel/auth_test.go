@@ -0,0 +1,109 @@
+package ssh_tunnel
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAuthMethodOrder(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		// exclusive only offers the credentials that are set
+		exclusive bool
+		// attempts are the methods and agent keys the server sees, in order
+		attempts []string
+		// messages are the reported attempts and results, in order
+		messages []string
+	}{
+		{
+			name:     "password accepted",
+			password: testPassword,
+			attempts: []string{"password"},
+			messages: []string{
+				"trying password authentication as root",
+				"password authentication as root succeeded",
+			},
+		},
+		{
+			name:     "password rejected",
+			password: "wrong",
+			// The keys of the ssh-server aren't offered with password authentication
+			attempts: []string{"password"},
+			messages: []string{
+				"trying password authentication as root",
+				"password authentication as root failed",
+			},
+		},
+		{
+			name:      "password rejected with exclusive auth",
+			password:  "wrong",
+			exclusive: true,
+			attempts:  []string{"password"},
+			messages: []string{
+				"trying password authentication as root",
+				"password authentication as root failed",
+			},
+		},
+		{
+			name:     "ssh-server keys",
+			attempts: []string{"publickey alice@laptop", "publickey deploy"},
+			messages: []string{
+				"trying publickey ssh-ed25519 alice@laptop from ssh-server authentication as root",
+				"publickey ssh-ed25519 alice@laptop from ssh-server authentication as root failed",
+				"trying publickey ssh-ed25519 deploy from ssh-server authentication as root",
+				"publickey ssh-ed25519 deploy from ssh-server authentication as root failed",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestServer(t)
+			socket, fingerprints, _ := newTestAgent(t, "alice@laptop", "deploy")
+
+			// Fingerprints are replaced by the comments of the keys to compare the attempts
+			comments := map[string]string{}
+			for comment, fingerprint := range fingerprints {
+				comments[fingerprint] = comment
+			}
+			replaceFingerprints := func(message string) string {
+				for fingerprint, comment := range comments {
+					message = strings.ReplaceAll(message, fingerprint, comment)
+				}
+				return message
+			}
+
+			tun, _ := newTestTunnel(t, server)
+			if test.password != "" {
+				tun.SetPassword(test.password)
+			} else {
+				tun.SetSSHServer()
+			}
+			tun.SetExclusiveAuth(test.exclusive)
+			tun.SetAgentSocket(socket)
+
+			var messages []string
+			tun.SetTunneledConnState(func(_ *SshTunnel, state *TunneledConnectionState) {
+				messages = append(messages, replaceFingerprints(state.Info))
+			})
+
+			sshClient, err := tun.Dial()
+			if err == nil {
+				sshClient.Close()
+			}
+
+			var attempts []string
+			for _, attempt := range server.attempts {
+				attempts = append(attempts, replaceFingerprints(attempt))
+			}
+			if !reflect.DeepEqual(attempts, test.attempts) {
+				t.Errorf("Expected the attempts %v, got %v", test.attempts, attempts)
+			}
+			if !reflect.DeepEqual(messages, test.messages) {
+				t.Errorf("Expected the messages\n%s\ngot\n%s", strings.Join(test.messages, "\n"), strings.Join(messages, "\n"))
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2024 Daytona Platforms Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package ssh_tunnel
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// CertificateExpiredError is returned when the certificate used for authentication is expired or not valid yet.
+type CertificateExpiredError struct {
+	KeyId       string
+	ValidAfter  time.Time
+	ValidBefore time.Time
+	NotYetValid bool
+}
+
+func (e *CertificateExpiredError) Error() string {
+	if e.NotYetValid {
+		return fmt.Sprintf("SSH certificate %q is not valid until %s", e.KeyId, e.ValidAfter.Format(time.RFC3339))
+	}
+	return fmt.Sprintf("SSH certificate %q expired at %s, request a new certificate", e.KeyId, e.ValidBefore.Format(time.RFC3339))
+}
+
+// SetCertificate changes the authentication to certificate-based and uses the specified private key and OpenSSH
+// user certificate files.
+// Leaving the certificate empty defaults to the `-cert.pub` file next to the private key. Leaving the private key
+// empty uses the key held by the ssh-server for the certificate, and leaving both empty uses all the certificates
+// held by the ssh-server.
+func (tun *SshTunnel) SetCertificate(keyFile string, certFile string) {
+	tun.authType = AuthTypeCertificate
+	tun.authKeyFile = keyFile
+	tun.authCertFile = certFile
+	tun.authPassword = ""
+}
+
+// SetEncryptedCertificate does the same as SetCertificate but the private key is decrypted with the password.
+func (tun *SshTunnel) SetEncryptedCertificate(keyFile string, certFile string, password string) {
+	tun.SetCertificate(keyFile, certFile)
+	tun.authPassword = password
+}
+
+func (tun *SshTunnel) getKeysForCertificate() ([]authKey, error) {
+	certFile := tun.authCertFile
+	if certFile == "" && tun.authKeyFile != "" {
+		certFile = tun.authKeyFile + "-cert.pub"
+	}
+
+	var cert *ssh.Certificate
+	if certFile != "" {
+		var err error
+		cert, err = readCertificate(certFile)
+		if err != nil {
+			return nil, err
+		}
+
+		err = checkCertificate(cert, time.Now())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if tun.authKeyFile == "" {
+		return tun.getKeysForSSHServerCertificates(cert)
+	}
+
+	buf, err := os.ReadFile(tun.authKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading SSH key file %s: %w", tun.authKeyFile, err)
+	}
+
+	key, err := tun.parseSigner(buf, tun.authPassword != "")
+	if err != nil {
+		return nil, fmt.Errorf("parsing SSH key file %s: %w", tun.authKeyFile, err)
+	}
+
+	if !bytes.Equal(cert.Key.Marshal(), key.PublicKey().Marshal()) {
+		return nil, fmt.Errorf("SSH certificate %s was not issued for the key %s", certFile, tun.authKeyFile)
+	}
+
+	signer, err := ssh.NewCertSigner(cert, key)
+	if err != nil {
+		return nil, fmt.Errorf("creating signer for SSH certificate %s: %w", certFile, err)
+	}
+
+	return []authKey{{signer: signer, source: certFile}}, nil
+}
+
+// getKeysForSSHServerCertificates uses the certificates held by the ssh-server. If cert is set, the ssh-server
+// only has to hold its key.
+func (tun *SshTunnel) getKeysForSSHServerCertificates(cert *ssh.Certificate) ([]authKey, error) {
+	signers, err := tun.getSSHServerSigners()
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []authKey
+	var expiredErr error
+	for _, signer := range signers {
+		if cert != nil {
+			if !bytes.Equal(signer.PublicKey().Marshal(), cert.Key.Marshal()) {
+				continue
+			}
+
+			certSigner, err := ssh.NewCertSigner(cert, signer)
+			if err != nil {
+				return nil, fmt.Errorf("creating signer for SSH certificate: %w", err)
+			}
+			keys = append(keys, authKey{signer: certSigner, source: "ssh-server"})
+			break
+		}
+
+		agentCert, ok := signer.PublicKey().(*ssh.Certificate)
+		if !ok {
+			continue
+		}
+		err := checkCertificate(agentCert, time.Now())
+		if err != nil {
+			expiredErr = err
+			continue
+		}
+		keys = append(keys, authKey{signer: signer, source: "ssh-server"})
+	}
+
+	if len(keys) == 0 {
+		if cert != nil {
+			return nil, fmt.Errorf("the key of SSH certificate %q is not held by ssh-server (use 'ssh-add' to add it to server)", cert.KeyId)
+		}
+		if expiredErr != nil {
+			return nil, expiredErr
+		}
+		return nil, fmt.Errorf("no certificates from ssh-server (use 'ssh-add' to add certificates to server)")
+	}
+
+	return keys, nil
+}
+
+func readCertificate(certFile string) (*ssh.Certificate, error) {
+	buf, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading SSH certificate file %s: %w", certFile, err)
+	}
+
+	pubKey, _, _, _, err := ssh.ParseAuthorizedKey(buf)
+	if err != nil {
+		return nil, fmt.Errorf("parsing SSH certificate file %s: %w", certFile, err)
+	}
+
+	cert, ok := pubKey.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("%s is a public key, not a SSH certificate", certFile)
+	}
+	if cert.CertType != ssh.UserCert {
+		return nil, fmt.Errorf("%s is not a SSH user certificate", certFile)
+	}
+
+	return cert, nil
+}
+
+// checkCertificate returns a CertificateExpiredError if the certificate is not valid at the given time.
+func checkCertificate(cert *ssh.Certificate, now time.Time) error {
+	unix := uint64(now.Unix())
+	if unix >= cert.ValidAfter && (cert.ValidBefore == ssh.CertTimeInfinity || unix < cert.ValidBefore) {
+		return nil
+	}
+
+	return &CertificateExpiredError{
+		KeyId:       cert.KeyId,
+		ValidAfter:  time.Unix(int64(cert.ValidAfter), 0),
+		ValidBefore: time.Unix(int64(cert.ValidBefore), 0),
+		NotYetValid: unix < cert.ValidAfter,
+	}
+}
@@ -0,0 +1,60 @@
+package ssh_tunnel
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestCheckCertificate(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name        string
+		cert        *ssh.Certificate
+		expired     bool
+		notYetValid bool
+	}{
+		{
+			name: "valid",
+			cert: &ssh.Certificate{ValidAfter: uint64(now.Add(-time.Hour).Unix()), ValidBefore: uint64(now.Add(time.Hour).Unix())},
+		},
+		{
+			name: "forever",
+			cert: &ssh.Certificate{ValidBefore: ssh.CertTimeInfinity},
+		},
+		{
+			name:    "expired",
+			cert:    &ssh.Certificate{ValidAfter: uint64(now.Add(-time.Hour).Unix()), ValidBefore: uint64(now.Add(-time.Minute).Unix())},
+			expired: true,
+		},
+		{
+			name:        "not yet valid",
+			cert:        &ssh.Certificate{ValidAfter: uint64(now.Add(time.Minute).Unix()), ValidBefore: uint64(now.Add(time.Hour).Unix())},
+			expired:     true,
+			notYetValid: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkCertificate(test.cert, now)
+			if !test.expired {
+				if err != nil {
+					t.Fatalf("Expected certificate to be valid, got %s", err)
+				}
+				return
+			}
+
+			var expiredErr *CertificateExpiredError
+			if !errors.As(err, &expiredErr) {
+				t.Fatalf("Expected CertificateExpiredError, got %v", err)
+			}
+			if expiredErr.NotYetValid != test.notYetValid {
+				t.Errorf("Expected NotYetValid to be %t, got %t", test.notYetValid, expiredErr.NotYetValid)
+			}
+		})
+	}
+}
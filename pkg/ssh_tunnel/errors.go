@@ -0,0 +1,91 @@
+// Copyright 2024 Daytona Platforms Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package ssh_tunnel
+
+import (
+	"errors"
+	"net"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	// ErrAuthFailed is matched by the errors of connections the server didn't authenticate, or that had no usable
+	// credentials to offer.
+	ErrAuthFailed = errors.New("ssh authentication failed")
+	// ErrHostUnreachable is matched by the errors of connections that couldn't reach the server, e.g. an unknown
+	// hostname, a refused connection or a timeout.
+	ErrHostUnreachable = errors.New("ssh host unreachable")
+	// ErrHostKeyMismatch is matched by HostKeyMismatchError.
+	ErrHostKeyMismatch = errors.New("ssh host key mismatch")
+	// ErrHostKeyUnknown is matched by HostKeyUnknownError and HostKeyNotRecordedError.
+	ErrHostKeyUnknown = errors.New("ssh host key unknown")
+	// ErrHostKeyNotRecorded is matched by HostKeyNotRecordedError.
+	ErrHostKeyNotRecorded = errors.New("ssh host key not recorded")
+)
+
+// DialError is returned when a SSH connection to Host can't be established. Depending on its cause it matches
+// ErrAuthFailed, ErrHostUnreachable, ErrHostKeyMismatch, ErrHostKeyNotRecorded or ErrHostKeyUnknown with errors.Is.
+type DialError struct {
+	// Host is the address the connection was made to.
+	Host string
+	Err  error
+}
+
+func (e *DialError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *DialError) Unwrap() error {
+	return e.Err
+}
+
+func (e *DialError) Is(target error) bool {
+	kind := classifyDialError(e.Err)
+	return kind != nil && target == kind
+}
+
+func (e *HostKeyMismatchError) Is(target error) bool {
+	return target == ErrHostKeyMismatch
+}
+
+func (e *HostKeyUnknownError) Is(target error) bool {
+	return target == ErrHostKeyUnknown
+}
+
+func (e *HostKeyNotRecordedError) Is(target error) bool {
+	return target == ErrHostKeyNotRecorded || target == ErrHostKeyUnknown
+}
+
+func (e *CertificateExpiredError) Is(target error) bool {
+	return target == ErrAuthFailed
+}
+
+// classifyDialError returns the sentinel matching the cause of a failed connection, nil if it's not known
+func classifyDialError(err error) error {
+	switch {
+	case errors.Is(err, ErrHostKeyMismatch):
+		return ErrHostKeyMismatch
+	case errors.Is(err, ErrHostKeyNotRecorded):
+		return ErrHostKeyNotRecorded
+	case errors.Is(err, ErrHostKeyUnknown):
+		return ErrHostKeyUnknown
+	case errors.Is(err, ErrAuthFailed), strings.Contains(err.Error(), "unable to authenticate"):
+		return ErrAuthFailed
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return ErrHostUnreachable
+	}
+
+	// Jump hosts reject the channels to servers they can't reach
+	var openChannelErr *ssh.OpenChannelError
+	if errors.As(err, &openChannelErr) && openChannelErr.Reason == ssh.ConnectionFailed {
+		return ErrHostUnreachable
+	}
+
+	return nil
+}
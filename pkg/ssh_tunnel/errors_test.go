@@ -0,0 +1,70 @@
+package ssh_tunnel
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestDialErrorKind(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected error
+	}{
+		{
+			name:     "auth",
+			err:      errors.New("ssh: handshake failed: ssh: unable to authenticate, attempted methods [none publickey], no supported methods remain"),
+			expected: ErrAuthFailed,
+		},
+		{
+			name:     "no credentials",
+			err:      fmt.Errorf("ssh config failed: %w", fmt.Errorf("%w: no usable keys", ErrAuthFailed)),
+			expected: ErrAuthFailed,
+		},
+		{
+			name:     "expired certificate",
+			err:      fmt.Errorf("ssh config failed: %w", &CertificateExpiredError{KeyId: "alice"}),
+			expected: ErrAuthFailed,
+		},
+		{
+			name:     "host key mismatch",
+			err:      fmt.Errorf("ssh: handshake failed: %w", &HostKeyMismatchError{Host: "docker.example.com:22"}),
+			expected: ErrHostKeyMismatch,
+		},
+		{
+			name:     "host key unknown",
+			err:      fmt.Errorf("ssh: handshake failed: %w", &HostKeyUnknownError{Host: "docker.example.com:22"}),
+			expected: ErrHostKeyUnknown,
+		},
+		{
+			name:     "connection refused",
+			err:      fmt.Errorf("ssh dial tcp failed: %w", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}),
+			expected: ErrHostUnreachable,
+		},
+		{
+			name:     "unreachable through jump host",
+			err:      fmt.Errorf("dial tcp through bastion failed: %w", &ssh.OpenChannelError{Reason: ssh.ConnectionFailed}),
+			expected: ErrHostUnreachable,
+		},
+		{
+			name: "unknown",
+			err:  errors.New("ssh: handshake failed: EOF"),
+		},
+	}
+
+	kinds := []error{ErrAuthFailed, ErrHostUnreachable, ErrHostKeyMismatch, ErrHostKeyUnknown}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := fmt.Errorf("failed to forward the docker socket: %w", &DialError{Host: "docker.example.com:22", Err: test.err})
+			for _, kind := range kinds {
+				if errors.Is(err, kind) != (kind == test.expected) {
+					t.Errorf("Expected errors.Is(err, %v) to be %t", kind, kind == test.expected)
+				}
+			}
+		})
+	}
+}
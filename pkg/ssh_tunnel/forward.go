@@ -9,6 +9,7 @@ import (
 	"io"
 	"net"
 
+	"golang.org/x/crypto/ssh"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -37,7 +38,7 @@ func (s *TunneledConnectionState) String() string {
 	return out
 }
 
-func (tun *SshTunnel) forward(localConn net.Conn) {
+func (tun *SshTunnel) forward(localConn net.Conn, sshClient *ssh.Client) {
 	from := localConn.RemoteAddr().String()
 
 	tun.tunneledState(&TunneledConnectionState{
@@ -45,7 +46,7 @@ func (tun *SshTunnel) forward(localConn net.Conn) {
 		Info: fmt.Sprintf("accepted %s connection", tun.local.Type()),
 	})
 
-	remoteConn, err := tun.SshClient.Dial(tun.remote.Type(), tun.remote.String())
+	remoteConn, err := sshClient.Dial(tun.remote.Type(), tun.remote.String())
 	if err != nil {
 		tun.tunneledState(&TunneledConnectionState{
 			From:  from,
@@ -59,6 +60,38 @@ func (tun *SshTunnel) forward(localConn net.Conn) {
 	connStr := fmt.Sprintf("%s -(%s)> %s -(ssh)> %s -(%s)> %s", from, tun.local.Type(), tun.local.String(),
 		tun.Server.String(), tun.remote.Type(), tun.remote.String())
 
+	tun.pipe(from, localConn, remoteConn, connStr)
+}
+
+// forwardReverse forwards a connection accepted on the remote host to the local endpoint.
+func (tun *SshTunnel) forwardReverse(remoteConn net.Conn) {
+	from := remoteConn.RemoteAddr().String()
+
+	tun.tunneledState(&TunneledConnectionState{
+		From: from,
+		Info: fmt.Sprintf("accepted remote %s connection", tun.remote.Type()),
+	})
+
+	dialer := net.Dialer{Timeout: tun.timeout}
+	localConn, err := dialer.DialContext(tun.ctx, tun.local.Type(), tun.local.String())
+	if err != nil {
+		tun.tunneledState(&TunneledConnectionState{
+			From:  from,
+			Error: fmt.Errorf("local dial %s to %s failed: %w", tun.local.Type(), tun.local.String(), err),
+		})
+
+		remoteConn.Close()
+		return
+	}
+
+	connStr := fmt.Sprintf("%s -(%s)> %s -(ssh)> %s -(%s)> %s", from, tun.remote.Type(), tun.remote.String(),
+		tun.Server.String(), tun.local.Type(), tun.local.String())
+
+	tun.pipe(from, localConn, remoteConn, connStr)
+}
+
+// pipe copies bytes between both connections until one of them is closed.
+func (tun *SshTunnel) pipe(from string, localConn net.Conn, remoteConn net.Conn, connStr string) {
 	tun.tunneledState(&TunneledConnectionState{
 		From:   from,
 		Info:   fmt.Sprintf("connection established: %s", connStr),
@@ -71,7 +104,7 @@ func (tun *SshTunnel) forward(localConn net.Conn) {
 
 	errGroup.Go(func() error {
 		defer connCancel()
-		_, err = io.Copy(remoteConn, localConn)
+		_, err := io.Copy(remoteConn, localConn)
 		if err != nil {
 			return fmt.Errorf("failed copying bytes from remote to local: %w", err)
 		}
@@ -80,14 +113,14 @@ func (tun *SshTunnel) forward(localConn net.Conn) {
 
 	errGroup.Go(func() error {
 		defer connCancel()
-		_, err = io.Copy(localConn, remoteConn)
+		_, err := io.Copy(localConn, remoteConn)
 		if err != nil {
 			return fmt.Errorf("failed copying bytes from local to remote: %w", err)
 		}
 		return localConn.Close()
 	})
 
-	err = errGroup.Wait()
+	err := errGroup.Wait()
 
 	<-connCtx.Done()
 
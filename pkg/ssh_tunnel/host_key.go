@@ -0,0 +1,276 @@
+// Copyright 2024 Daytona Platforms Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package ssh_tunnel
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// HostKeyPolicy controls how the host key presented by the SSH server is verified.
+type HostKeyPolicy string
+
+const (
+	// HostKeyPolicyStrict only accepts host keys that are already present in one of the known hosts files.
+	HostKeyPolicyStrict HostKeyPolicy = "strict"
+	// HostKeyPolicyTrustOnFirstUse accepts and records the key of a host that is not known yet, but rejects
+	// keys that don't match a previously recorded one.
+	HostKeyPolicyTrustOnFirstUse HostKeyPolicy = "trust-on-first-use"
+	// HostKeyPolicyInsecure accepts any host key without verification.
+	HostKeyPolicyInsecure HostKeyPolicy = "insecure"
+)
+
+// HostKeyPolicies lists all supported host key policies.
+var HostKeyPolicies = []HostKeyPolicy{HostKeyPolicyStrict, HostKeyPolicyTrustOnFirstUse, HostKeyPolicyInsecure}
+
+// HostKeyMismatchError is returned when the server presents a host key that differs from the one recorded
+// in the known hosts files. This may indicate a man-in-the-middle attack.
+type HostKeyMismatchError struct {
+	// Host is the address the connection was made to.
+	Host string
+	// Fingerprint is the SHA256 fingerprint of the key presented by the server.
+	Fingerprint string
+	// Known holds the keys recorded for the host.
+	Known []knownhosts.KnownKey
+}
+
+func (e *HostKeyMismatchError) Error() string {
+	known := make([]string, 0, len(e.Known))
+	for _, k := range e.Known {
+		known = append(known, fmt.Sprintf("%s (%s:%d)", ssh.FingerprintSHA256(k.Key), k.Filename, k.Line))
+	}
+	return fmt.Sprintf("host key mismatch for %s: server presented %s, expected %s", e.Host, e.Fingerprint, strings.Join(known, ", "))
+}
+
+// HostKeyUnknownError is returned by the strict policy when the host is not present in any known hosts file.
+type HostKeyUnknownError struct {
+	// Host is the address the connection was made to.
+	Host string
+	// Fingerprint is the SHA256 fingerprint of the key presented by the server.
+	Fingerprint string
+}
+
+func (e *HostKeyUnknownError) Error() string {
+	return fmt.Sprintf("host key for %s is not known (server presented %s)", e.Host, e.Fingerprint)
+}
+
+// HostKeyNotRecordedError is returned by the trust-on-first-use policy when the key of a host that isn't known yet
+// can't be recorded in the managed known hosts file. The key isn't trusted then, the connection fails.
+type HostKeyNotRecordedError struct {
+	// Host is the address the connection was made to.
+	Host string
+	// Fingerprint is the SHA256 fingerprint of the key presented by the server.
+	Fingerprint string
+	// File is the managed known hosts file, empty if none is set.
+	File string
+	Err  error
+}
+
+func (e *HostKeyNotRecordedError) Error() string {
+	file := e.File
+	if file == "" {
+		file = "the managed known hosts file"
+	}
+	return fmt.Sprintf("host key %s of %s is not trusted, trust on first use failed to record it in %s: %v", e.Fingerprint, e.Host, file, e.Err)
+}
+
+func (e *HostKeyNotRecordedError) Unwrap() error {
+	return e.Err
+}
+
+// knownHostsMutex serializes writes to the managed known hosts files of all tunnels.
+var knownHostsMutex sync.Mutex
+
+func defaultKnownHostsFiles() []string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+	return []string{filepath.Join(homeDir, ".ssh", "known_hosts")}
+}
+
+// hostKeyCallback returns the callback verifying the host key and the host key algorithms to ask the server for.
+// The algorithms are restricted to the key types recorded for the host, otherwise the server could present a key of
+// another type (x/crypto prefers ECDSA over Ed25519) that would be reported as a mismatch. They are nil if the host
+// isn't known yet.
+func (tun *SshTunnel) hostKeyCallback() (ssh.HostKeyCallback, []string, error) {
+	switch tun.hostKeyPolicy {
+	case HostKeyPolicyInsecure:
+		return ssh.InsecureIgnoreHostKey(), nil, nil
+	case HostKeyPolicyStrict, HostKeyPolicyTrustOnFirstUse:
+	default:
+		return nil, nil, fmt.Errorf("unknown host key policy: %s", tun.hostKeyPolicy)
+	}
+
+	files := existingFiles(append(append([]string{}, tun.knownHostsFiles...), tun.managedKnownHosts))
+
+	var known ssh.HostKeyCallback
+	var algorithms []string
+	if len(files) > 0 {
+		var err error
+		known, err = knownhosts.New(files...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading known hosts: %w", err)
+		}
+		algorithms = knownHostKeyAlgorithms(known, tun.Server.String())
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if known != nil {
+			err := known(hostname, remote, key)
+			if err == nil {
+				return nil
+			}
+
+			var keyErr *knownhosts.KeyError
+			if !errors.As(err, &keyErr) {
+				return err
+			}
+			if len(keyErr.Want) > 0 {
+				return &HostKeyMismatchError{
+					Host:        hostname,
+					Fingerprint: ssh.FingerprintSHA256(key),
+					Known:       keyErr.Want,
+				}
+			}
+		}
+
+		if tun.hostKeyPolicy == HostKeyPolicyStrict {
+			return &HostKeyUnknownError{
+				Host:        hostname,
+				Fingerprint: ssh.FingerprintSHA256(key),
+			}
+		}
+
+		return tun.trustHostKey(hostname, remote, key)
+	}, algorithms, nil
+}
+
+// knownHostKeyAlgorithms returns the host key algorithms matching the keys recorded for the host, nil if there are
+// none. The keys are listed by checking a key no host has.
+func knownHostKeyAlgorithms(known ssh.HostKeyCallback, hostname string) []string {
+	err := known(hostname, &net.TCPAddr{}, unknownKey{})
+
+	var keyErr *knownhosts.KeyError
+	if !errors.As(err, &keyErr) {
+		return nil
+	}
+
+	var algorithms []string
+	for _, knownKey := range keyErr.Want {
+		switch keyType := knownKey.Key.Type(); keyType {
+		case ssh.KeyAlgoRSA:
+			// RSA keys are used with the SHA-2 signatures, ssh-rsa (SHA-1) is disabled by most servers
+			algorithms = append(algorithms, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA)
+		default:
+			algorithms = append(algorithms, keyType)
+		}
+	}
+
+	return algorithms
+}
+
+// unknownKey is a public key that isn't recorded for any host
+type unknownKey struct{}
+
+func (unknownKey) Type() string {
+	return "unknown"
+}
+
+func (unknownKey) Marshal() []byte {
+	return nil
+}
+
+func (unknownKey) Verify(data []byte, sig *ssh.Signature) error {
+	return errors.New("unknown key")
+}
+
+// trustHostKey records the host key in the managed known hosts file. The file is checked again before writing
+// since another connection may have recorded the host in the meantime. A key that can't be recorded isn't trusted.
+func (tun *SshTunnel) trustHostKey(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	notRecorded := func(err error) error {
+		return &HostKeyNotRecordedError{
+			Host:        hostname,
+			Fingerprint: ssh.FingerprintSHA256(key),
+			File:        tun.managedKnownHosts,
+			Err:         err,
+		}
+	}
+
+	if tun.managedKnownHosts == "" {
+		return notRecorded(errors.New("no managed known hosts file is set"))
+	}
+
+	knownHostsMutex.Lock()
+	defer knownHostsMutex.Unlock()
+
+	if len(existingFiles([]string{tun.managedKnownHosts})) > 0 {
+		managed, err := knownhosts.New(tun.managedKnownHosts)
+		if err != nil {
+			return notRecorded(fmt.Errorf("reading known hosts: %w", err))
+		}
+
+		err = managed(hostname, remote, key)
+		if err == nil {
+			return nil
+		}
+
+		var keyErr *knownhosts.KeyError
+		if !errors.As(err, &keyErr) {
+			return notRecorded(err)
+		}
+		if len(keyErr.Want) > 0 {
+			return &HostKeyMismatchError{
+				Host:        hostname,
+				Fingerprint: ssh.FingerprintSHA256(key),
+				Known:       keyErr.Want,
+			}
+		}
+	}
+
+	err := os.MkdirAll(filepath.Dir(tun.managedKnownHosts), 0700)
+	if err != nil {
+		return notRecorded(fmt.Errorf("creating known hosts dir: %w", err))
+	}
+
+	f, err := os.OpenFile(tun.managedKnownHosts, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return notRecorded(fmt.Errorf("opening known hosts file: %w", err))
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintln(f, knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key))
+	if err != nil {
+		return notRecorded(fmt.Errorf("writing known hosts file: %w", err))
+	}
+
+	// The first connection isn't verified, the key is reported so it can be checked against the host
+	tun.tunneledState(&TunneledConnectionState{
+		From: tun.Server.String(),
+		Info: fmt.Sprintf("trusted host key %s of %s on first use, recorded in %s", ssh.FingerprintSHA256(key), hostname, tun.managedKnownHosts),
+	})
+
+	return nil
+}
+
+func existingFiles(files []string) []string {
+	var existing []string
+	for _, file := range files {
+		if file == "" {
+			continue
+		}
+		if _, err := os.Stat(file); err == nil {
+			existing = append(existing, file)
+		}
+	}
+	return existing
+}
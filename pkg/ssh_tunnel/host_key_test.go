@@ -0,0 +1,237 @@
+package ssh_tunnel
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const testHost = "docker.example.com:22"
+
+var testRemote = &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 22}
+
+func newEd25519HostKey(t *testing.T) ssh.PublicKey {
+	publicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func newEcdsaHostKey(t *testing.T) ssh.PublicKey {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// newKnownHostsTunnel returns a dialer using a temporary known hosts file holding the keys and a managed known
+// hosts file next to it
+func newKnownHostsTunnel(t *testing.T, policy HostKeyPolicy, keys ...ssh.PublicKey) (*SshTunnel, string) {
+	dir := t.TempDir()
+
+	knownHostsFile := filepath.Join(dir, "known_hosts")
+	var lines []string
+	for _, key := range keys {
+		lines = append(lines, knownhosts.Line([]string{knownhosts.Normalize(testHost)}, key))
+	}
+	err := os.WriteFile(knownHostsFile, []byte(strings.Join(lines, "\n")+"\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	managedFile := filepath.Join(dir, "managed_known_hosts")
+
+	tun := NewDialer("docker.example.com")
+	tun.SetHostKeyPolicy(policy)
+	tun.SetKnownHostsFiles(knownHostsFile)
+	tun.SetManagedKnownHostsFile(managedFile)
+
+	return tun, managedFile
+}
+
+func TestHostKeyStrict(t *testing.T) {
+	knownKey := newEd25519HostKey(t)
+	tun, managedFile := newKnownHostsTunnel(t, HostKeyPolicyStrict, knownKey)
+
+	callback, algorithms, err := tun.hostKeyCallback()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(algorithms) != 1 || algorithms[0] != ssh.KeyAlgoED25519 {
+		t.Errorf("Expected the host key algorithms to be restricted to %s, got %v", ssh.KeyAlgoED25519, algorithms)
+	}
+
+	err = callback(testHost, testRemote, knownKey)
+	if err != nil {
+		t.Errorf("Expected the known key to be accepted, got %s", err)
+	}
+
+	err = callback("other.example.com:22", testRemote, newEd25519HostKey(t))
+	var unknownErr *HostKeyUnknownError
+	if !errors.As(err, &unknownErr) {
+		t.Errorf("Expected HostKeyUnknownError for an unknown host, got %v", err)
+	}
+
+	if _, err := os.Stat(managedFile); !os.IsNotExist(err) {
+		t.Errorf("Expected the strict policy not to record host keys")
+	}
+}
+
+func TestHostKeyTrustOnFirstUse(t *testing.T) {
+	tun, managedFile := newKnownHostsTunnel(t, HostKeyPolicyTrustOnFirstUse)
+	hostKey := newEd25519HostKey(t)
+
+	callback, algorithms, err := tun.hostKeyCallback()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if algorithms != nil {
+		t.Errorf("Expected no host key algorithms for an unknown host, got %v", algorithms)
+	}
+
+	err = callback(testHost, testRemote, hostKey)
+	if err != nil {
+		t.Fatalf("Expected the first key to be trusted, got %s", err)
+	}
+
+	content, err := os.ReadFile(managedFile)
+	if err != nil {
+		t.Fatalf("Expected the key to be recorded: %s", err)
+	}
+	if !strings.Contains(string(content), ssh.KeyAlgoED25519) {
+		t.Errorf("Expected the recorded line to hold the key, got %q", content)
+	}
+
+	// A new callback reads the recorded key
+	callback, algorithms, err = tun.hostKeyCallback()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(algorithms) != 1 || algorithms[0] != ssh.KeyAlgoED25519 {
+		t.Errorf("Expected the recorded key type to restrict the host key algorithms, got %v", algorithms)
+	}
+
+	err = callback(testHost, testRemote, hostKey)
+	if err != nil {
+		t.Errorf("Expected the recorded key to be accepted, got %s", err)
+	}
+
+	err = callback(testHost, testRemote, newEd25519HostKey(t))
+	var mismatchErr *HostKeyMismatchError
+	if !errors.As(err, &mismatchErr) {
+		t.Errorf("Expected HostKeyMismatchError for a changed key, got %v", err)
+	}
+}
+
+func TestHostKeyTrustOnFirstUseWithoutManagedFile(t *testing.T) {
+	tun, _ := newKnownHostsTunnel(t, HostKeyPolicyTrustOnFirstUse)
+	tun.SetManagedKnownHostsFile("")
+
+	callback, _, err := tun.hostKeyCallback()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = callback(testHost, testRemote, newEd25519HostKey(t))
+	if !errors.Is(err, ErrHostKeyNotRecorded) || !errors.Is(err, ErrHostKeyUnknown) {
+		t.Errorf("Expected the key to be rejected without a file to record it in, got %v", err)
+	}
+}
+
+func TestHostKeyTrustOnFirstUseUnwritableFile(t *testing.T) {
+	tun, _ := newKnownHostsTunnel(t, HostKeyPolicyTrustOnFirstUse)
+
+	// The parent of the managed file is a file, so it can't be created even as root
+	parent := filepath.Join(t.TempDir(), "file")
+	err := os.WriteFile(parent, nil, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	managedFile := filepath.Join(parent, "known_hosts")
+	tun.SetManagedKnownHostsFile(managedFile)
+
+	callback, _, err := tun.hostKeyCallback()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = callback(testHost, testRemote, newEd25519HostKey(t))
+	var notRecordedErr *HostKeyNotRecordedError
+	if !errors.As(err, &notRecordedErr) {
+		t.Fatalf("Expected HostKeyNotRecordedError, got %v", err)
+	}
+	if notRecordedErr.File != managedFile || !strings.Contains(err.Error(), managedFile) {
+		t.Errorf("Expected the error to name the managed file, got %v", err)
+	}
+}
+
+func TestHostKeyMismatch(t *testing.T) {
+	tun, _ := newKnownHostsTunnel(t, HostKeyPolicyTrustOnFirstUse, newEd25519HostKey(t))
+
+	callback, _, err := tun.hostKeyCallback()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = callback(testHost, testRemote, newEd25519HostKey(t))
+	var mismatchErr *HostKeyMismatchError
+	if !errors.As(err, &mismatchErr) {
+		t.Fatalf("Expected HostKeyMismatchError, got %v", err)
+	}
+	if len(mismatchErr.Known) != 1 {
+		t.Errorf("Expected the known key in the error, got %v", mismatchErr.Known)
+	}
+}
+
+func TestHostKeyDifferentKeyType(t *testing.T) {
+	ed25519Key := newEd25519HostKey(t)
+	ecdsaKey := newEcdsaHostKey(t)
+
+	tun, _ := newKnownHostsTunnel(t, HostKeyPolicyStrict, ed25519Key)
+	_, algorithms, err := tun.hostKeyCallback()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Without the restriction the server would present its ECDSA key and fail the check
+	for _, algorithm := range algorithms {
+		if algorithm == ecdsaKey.Type() {
+			t.Errorf("Expected %s not to be asked for, got %v", ecdsaKey.Type(), algorithms)
+		}
+	}
+
+	tun, _ = newKnownHostsTunnel(t, HostKeyPolicyStrict, ed25519Key, ecdsaKey)
+	callback, algorithms, err := tun.hostKeyCallback()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(algorithms) != 2 {
+		t.Errorf("Expected both key types to be asked for, got %v", algorithms)
+	}
+	for _, key := range []ssh.PublicKey{ed25519Key, ecdsaKey} {
+		err = callback(testHost, testRemote, key)
+		if err != nil {
+			t.Errorf("Expected the %s key to be accepted, got %s", key.Type(), err)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2024 Daytona Platforms Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package ssh_tunnel
+
+import (
+	"fmt"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SetJumpHosts sets an ordered chain of jump hosts the connection to the server is made through (like `ssh -J`).
+// Each jump host is a SSH tunnel created with NewDialer and configured with its own user, port and authentication.
+func (tun *SshTunnel) SetJumpHosts(jumpHosts ...*SshTunnel) {
+	tun.jumpHosts = jumpHosts
+}
+
+// dialThroughJumpHosts connects to each jump host in order through the previous one and finally to the server.
+// The connections to the jump hosts are closed once the connection to the server is closed.
+func (tun *SshTunnel) dialThroughJumpHosts() (*ssh.Client, error) {
+	var clients []*ssh.Client
+	closeAll := func() {
+		for i := len(clients) - 1; i >= 0; i-- {
+			clients[i].Close()
+		}
+	}
+
+	var via *ssh.Client
+	for _, jumpHost := range tun.jumpHosts {
+		client, err := jumpHost.dialVia(via)
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("jump host %s: %w", jumpHost.Server.String(), err)
+		}
+		clients = append(clients, client)
+		via = client
+	}
+
+	sshClient, err := tun.dialVia(via)
+	if err != nil {
+		closeAll()
+		return nil, err
+	}
+
+	go func() {
+		sshClient.Wait()
+		closeAll()
+	}()
+
+	return sshClient, nil
+}
@@ -0,0 +1,146 @@
+// Copyright 2024 Daytona Platforms Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package ssh_tunnel
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// KeyboardInteractiveResponder answers a single keyboard-interactive prompt of the server. Echo reports whether
+// the server would show the answer while it's typed (it's false for secrets).
+type KeyboardInteractiveResponder func(instruction string, question string, echo bool) (string, error)
+
+// SetKeyboardInteractive changes the authentication to keyboard-interactive and answers the server's prompts with
+// the responder.
+func (tun *SshTunnel) SetKeyboardInteractive(responder KeyboardInteractiveResponder) {
+	tun.authType = AuthTypeKeyboardInteractive
+	tun.kbdResponder = responder
+}
+
+// SetKeyboardInteractiveResponder adds keyboard-interactive authentication after the current authentication
+// method, e.g. for servers that require a one-time password after the key or the password.
+// With password authentication, the prompts asking for the password are still answered with the password.
+func (tun *SshTunnel) SetKeyboardInteractiveResponder(responder KeyboardInteractiveResponder) {
+	tun.kbdResponder = responder
+}
+
+// SetKeyboardInteractiveID identifies the answers of the responder, e.g. with a hash of the settings it was created
+// from. Pooled connections are only shared between tunnels whose responders have the same ID.
+func (tun *SshTunnel) SetKeyboardInteractiveID(id string) {
+	tun.kbdResponderID = id
+}
+
+// StaticResponder answers the prompts with the given answers, in order. Once all the answers are used, it starts
+// over with the first one so the same answers are given when the tunnel reconnects.
+func StaticResponder(answers ...string) KeyboardInteractiveResponder {
+	var mutex sync.Mutex
+	next := 0
+
+	return func(instruction string, question string, echo bool) (string, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if len(answers) == 0 {
+			return "", fmt.Errorf("no answer for keyboard-interactive prompt %q", question)
+		}
+
+		answer := answers[next]
+		next = (next + 1) % len(answers)
+		return answer, nil
+	}
+}
+
+// commandResponderTimeout bounds the keyboard-interactive command, like the `cmd:` secret references
+const commandResponderTimeout = 30 * time.Second
+
+// CommandResponder runs the command with `sh -c` for every prompt and answers with its output. The prompt is
+// passed in the DAYTONA_SSH_PROMPT and DAYTONA_SSH_INSTRUCTION environment variables. The command is killed if it
+// doesn't answer within 30 seconds.
+func CommandResponder(command string) KeyboardInteractiveResponder {
+	return commandResponder(command, commandResponderTimeout)
+}
+
+func commandResponder(command string, timeout time.Duration) KeyboardInteractiveResponder {
+	return func(instruction string, question string, echo bool) (string, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		var stderr bytes.Buffer
+
+		cmd := exec.CommandContext(ctx, "sh", "-c", command)
+		cmd.Env = append(os.Environ(), "DAYTONA_SSH_PROMPT="+question, "DAYTONA_SSH_INSTRUCTION="+instruction)
+		cmd.Stderr = &stderr
+		// Children of the shell holding its output open don't delay the timeout
+		cmd.WaitDelay = time.Second
+
+		out, err := cmd.Output()
+		if err != nil {
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return "", fmt.Errorf("keyboard-interactive command timed out after %s answering %q", timeout, question)
+			}
+			return "", fmt.Errorf("keyboard-interactive command failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+		}
+
+		return strings.TrimRight(string(out), "\r\n"), nil
+	}
+}
+
+// TOTPResponder answers the prompts with the current time-based one-time password (RFC 6238, 6 digits, 30
+// seconds) generated from the base32 encoded secret.
+func TOTPResponder(secret string) KeyboardInteractiveResponder {
+	return func(instruction string, question string, echo bool) (string, error) {
+		key, err := decodeTOTPSecret(secret)
+		if err != nil {
+			return "", err
+		}
+		return totpCode(key, time.Now(), 6), nil
+	}
+}
+
+func decodeTOTPSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	secret = strings.TrimRight(secret, "=")
+
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TOTP secret, it must be base32 encoded: %w", err)
+	}
+	return key, nil
+}
+
+func totpCode(key []byte, now time.Time, digits int) string {
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(now.Unix()/30))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", digits, code%mod)
+}
+
+// isPasswordPrompt reports whether a keyboard-interactive prompt asks for the password of the user.
+func isPasswordPrompt(question string) bool {
+	return strings.Contains(strings.ToLower(question), "password")
+}
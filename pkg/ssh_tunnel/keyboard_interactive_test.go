@@ -0,0 +1,66 @@
+package ssh_tunnel
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTotpCode(t *testing.T) {
+	// Test vectors from RFC 6238 for the SHA1 key "12345678901234567890"
+	key, err := decodeTOTPSecret("GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ")
+	if err != nil {
+		t.Fatalf("Error decoding TOTP secret: %s", err)
+	}
+
+	tests := map[int64]string{
+		59:         "94287082",
+		1111111109: "07081804",
+		1234567890: "89005924",
+		2000000000: "69279037",
+	}
+
+	for unix, expected := range tests {
+		code := totpCode(key, time.Unix(unix, 0), 8)
+		if code != expected {
+			t.Errorf("Expected code %s at %d, got %s", expected, unix, code)
+		}
+	}
+}
+
+func TestStaticResponder(t *testing.T) {
+	responder := StaticResponder("1234", "5678")
+
+	for _, expected := range []string{"1234", "5678", "1234"} {
+		answer, err := responder("", "Code: ", false)
+		if err != nil {
+			t.Fatalf("Error answering prompt: %s", err)
+		}
+		if answer != expected {
+			t.Errorf("Expected answer %s, got %s", expected, answer)
+		}
+	}
+
+	_, err := StaticResponder()("", "Code: ", false)
+	if err == nil {
+		t.Errorf("Expected an error without answers")
+	}
+}
+
+func TestCommandResponderTimeout(t *testing.T) {
+	responder := commandResponder("echo 123456; sleep 10", time.Millisecond*100)
+
+	start := time.Now()
+	_, err := responder("", "Verification code: ", false)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Expected a timeout error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second*5 {
+		t.Errorf("Expected the command to be killed, it ran for %s", elapsed)
+	}
+
+	answer, err := commandResponder("echo $DAYTONA_SSH_PROMPT", time.Second*5)("", "Code", false)
+	if err != nil || answer != "Code" {
+		t.Errorf("Expected the command to answer the prompt, got %q, %v", answer, err)
+	}
+}
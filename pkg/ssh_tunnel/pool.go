@@ -0,0 +1,344 @@
+// Copyright 2024 Daytona Platforms Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package ssh_tunnel
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// DefaultPool is the pool shared by all tunnels and callers that don't need a separate one.
+var DefaultPool = NewPool(time.Minute*5, time.Second*30)
+
+// Pool shares SSH connections between tunnels and other callers. Connections are keyed by the server, user,
+// credentials, host key settings and jump hosts of the tunnel that dialed them, so only tunnels that would open
+// an identical connection share it.
+// Connections that are not in use are closed after the idle timeout and connections in use are health checked
+// with keepalive requests.
+type Pool struct {
+	mutex               sync.Mutex
+	clients             map[string]*pooledClient
+	byClient            map[*ssh.Client]*pooledClient
+	idleTimeout         time.Duration
+	healthCheckInterval time.Duration
+	healthCheckStarted  bool
+	closed              chan struct{}
+}
+
+type pooledClient struct {
+	// keys holds the key of the tunnel that dialed the connection and the keys added by GetKeyed
+	keys     []string
+	client   *ssh.Client
+	err      error
+	ready    chan struct{}
+	refs     int
+	lastUsed time.Time
+	// done is closed once the connection is closed
+	done chan struct{}
+}
+
+// PooledClientInfo describes a connection in the pool (useful for diagnostics).
+type PooledClientInfo struct {
+	Server   string
+	User     string
+	Refs     int
+	LastUsed time.Time
+}
+
+// NewPool creates a SSH connection pool. Unused connections are closed after idleTimeout and all connections
+// are health checked every healthCheckInterval.
+func NewPool(idleTimeout time.Duration, healthCheckInterval time.Duration) *Pool {
+	return &Pool{
+		clients:             map[string]*pooledClient{},
+		byClient:            map[*ssh.Client]*pooledClient{},
+		idleTimeout:         idleTimeout,
+		healthCheckInterval: healthCheckInterval,
+		closed:              make(chan struct{}),
+	}
+}
+
+// Get returns a connection to the tunnel's server, dialing it if the pool doesn't hold one yet.
+// Concurrent calls for the same key wait for a single dial. Release must be called once the connection isn't needed anymore.
+func (p *Pool) Get(tun *SshTunnel) (*ssh.Client, error) {
+	key, err := tun.poolKey()
+	if err != nil {
+		return nil, err
+	}
+
+	p.mutex.Lock()
+	p.startHealthCheck()
+
+	entry, ok := p.clients[key]
+	if ok {
+		return p.wait(entry)
+	}
+
+	entry = &pooledClient{
+		keys:     []string{key},
+		ready:    make(chan struct{}),
+		refs:     1,
+		lastUsed: time.Now(),
+		done:     make(chan struct{}),
+	}
+	p.clients[key] = entry
+	p.mutex.Unlock()
+
+	entry.client, entry.err = tun.Dial()
+	close(entry.ready)
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if entry.err != nil {
+		p.removeKeys(entry)
+		return nil, entry.err
+	}
+
+	p.byClient[entry.client] = entry
+	go p.watch(entry)
+
+	return entry.client, nil
+}
+
+// GetKeyed returns the connection held under key, which identifies the settings newTun creates the tunnel from.
+// newTun is only called if the pool doesn't hold a connection under key, so the secrets of the tunnel aren't
+// resolved again for every call. The connection is then shared under both key and the key of the tunnel, which is
+// stopped once it dialed. Release must be called once the connection isn't needed anymore.
+func (p *Pool) GetKeyed(key string, newTun func() (*SshTunnel, error)) (*ssh.Client, error) {
+	p.mutex.Lock()
+	p.startHealthCheck()
+	entry, ok := p.clients[key]
+	if ok {
+		return p.wait(entry)
+	}
+	p.mutex.Unlock()
+
+	tun, err := newTun()
+	if err != nil {
+		return nil, err
+	}
+	// The tunnel isn't used again, this closes its connection to the ssh-agent
+	defer tun.Stop()
+
+	client, err := p.Get(tun)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	entry, ok = p.byClient[client]
+	if ok && p.clients[key] == nil {
+		p.clients[key] = entry
+		entry.keys = append(entry.keys, key)
+	}
+
+	return client, nil
+}
+
+// wait adds a reference to a connection of the pool and waits until it's dialed. It's called with the mutex
+// locked and unlocks it.
+func (p *Pool) wait(entry *pooledClient) (*ssh.Client, error) {
+	entry.refs++
+	entry.lastUsed = time.Now()
+	p.mutex.Unlock()
+
+	<-entry.ready
+	if entry.err != nil {
+		return nil, entry.err
+	}
+	return entry.client, nil
+}
+
+// Release marks a connection returned by Get as no longer used by the caller.
+func (p *Pool) Release(client *ssh.Client) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	entry, ok := p.byClient[client]
+	if !ok {
+		return
+	}
+
+	entry.refs--
+	entry.lastUsed = time.Now()
+}
+
+// Invalidate removes a broken connection from the pool and closes it. Callers still holding it will see it fail.
+func (p *Pool) Invalidate(client *ssh.Client) {
+	p.mutex.Lock()
+	p.remove(client)
+	p.mutex.Unlock()
+
+	client.Close()
+}
+
+// clientClosed returns a channel that is closed once the pooled connection is closed, nil if the pool doesn't hold it.
+func (p *Pool) clientClosed(client *ssh.Client) <-chan struct{} {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	entry, ok := p.byClient[client]
+	if !ok {
+		return nil
+	}
+	return entry.done
+}
+
+// List returns the connections currently in the pool.
+func (p *Pool) List() []PooledClientInfo {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	var infos []PooledClientInfo
+	for client, entry := range p.byClient {
+		infos = append(infos, PooledClientInfo{
+			Server:   client.RemoteAddr().String(),
+			User:     client.User(),
+			Refs:     entry.refs,
+			LastUsed: entry.lastUsed,
+		})
+	}
+	return infos
+}
+
+// Close closes all connections in the pool and stops the health checks.
+func (p *Pool) Close() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	select {
+	case <-p.closed:
+	default:
+		close(p.closed)
+	}
+
+	for client := range p.byClient {
+		client.Close()
+	}
+	p.clients = map[string]*pooledClient{}
+	p.byClient = map[*ssh.Client]*pooledClient{}
+}
+
+// watch removes the connection from the pool once it's closed.
+func (p *Pool) watch(entry *pooledClient) {
+	entry.client.Wait()
+	close(entry.done)
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.remove(entry.client)
+}
+
+func (p *Pool) remove(client *ssh.Client) {
+	entry, ok := p.byClient[client]
+	if !ok {
+		return
+	}
+
+	delete(p.byClient, client)
+	p.removeKeys(entry)
+}
+
+func (p *Pool) removeKeys(entry *pooledClient) {
+	for _, key := range entry.keys {
+		if p.clients[key] == entry {
+			delete(p.clients, key)
+		}
+	}
+}
+
+func (p *Pool) startHealthCheck() {
+	if p.healthCheckStarted || p.healthCheckInterval <= 0 {
+		return
+	}
+	p.healthCheckStarted = true
+
+	go func() {
+		ticker := time.NewTicker(p.healthCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-p.closed:
+				return
+			case <-ticker.C:
+				p.healthCheck()
+			}
+		}
+	}()
+}
+
+// healthCheck closes idle connections and sends a keepalive request on the others, closing the ones that don't answer.
+func (p *Pool) healthCheck() {
+	var inUse []*ssh.Client
+
+	p.mutex.Lock()
+	for client, entry := range p.byClient {
+		if entry.refs <= 0 && time.Since(entry.lastUsed) > p.idleTimeout {
+			p.remove(client)
+			client.Close()
+			continue
+		}
+		inUse = append(inUse, client)
+	}
+	p.mutex.Unlock()
+
+	for _, client := range inUse {
+		err := sendKeepAlive(client, p.healthCheckInterval)
+		if err != nil {
+			p.Invalidate(client)
+		}
+	}
+}
+
+// poolKey identifies the connection the tunnel would open. Credentials are only included as hashes and
+// fingerprints, so the SSH config is initialized first.
+func (tun *SshTunnel) poolKey() (string, error) {
+	_, err := tun.sshConfig()
+	if err != nil {
+		return "", fmt.Errorf("ssh config failed: %w", err)
+	}
+
+	kbd := ""
+	if tun.kbdResponder != nil {
+		kbd = tun.kbdResponderID
+		if kbd == "" {
+			// The answers of a responder without an ID are unknown, its connections aren't shared with other tunnels
+			kbd = fmt.Sprintf("%p", tun)
+		}
+	}
+
+	key := fmt.Sprintf("%s@%s|auth=%d|keys=%s|password=%x|agent=%t|agentsock=%s|identities=%s|kbd=%s|hostkey=%s|known=%s|%s",
+		tun.user,
+		tun.Server.String(),
+		tun.authType,
+		strings.Join(tun.keyFingerprints, ","),
+		sha256.Sum256([]byte(tun.authPassword)),
+		!tun.identitiesOnly && !tun.exclusiveAuth,
+		tun.agentSocket(),
+		strings.Join(tun.agentIdentities, ","),
+		kbd,
+		tun.hostKeyPolicy,
+		strings.Join(tun.knownHostsFiles, ","),
+		tun.managedKnownHosts,
+	)
+
+	for _, jumpHost := range tun.jumpHosts {
+		jumpKey, err := jumpHost.poolKey()
+		if err != nil {
+			return "", err
+		}
+		key += "|jump=" + jumpKey
+	}
+
+	return key, nil
+}
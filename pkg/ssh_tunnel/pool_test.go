@@ -0,0 +1,256 @@
+package ssh_tunnel
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func newTestPool(t *testing.T, idleTimeout time.Duration) *Pool {
+	// The health check is run by the tests themselves, the interval is the timeout of its keepalives
+	pool := NewPool(idleTimeout, time.Hour)
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+func (s *testServer) connCount() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return len(s.conns)
+}
+
+func TestPoolGet(t *testing.T) {
+	server := newTestServer(t)
+	pool := newTestPool(t, time.Minute)
+
+	var wg sync.WaitGroup
+	clients := make([]*ssh.Client, 5)
+	for i := range clients {
+		tun, _ := newTestTunnel(t, server)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			client, err := pool.Get(tun)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			clients[i] = client
+		}()
+	}
+	wg.Wait()
+
+	for _, client := range clients {
+		if client == nil || client != clients[0] {
+			t.Fatalf("Expected all tunnels to share one connection")
+		}
+	}
+	if server.connCount() != 1 {
+		t.Errorf("Expected a single dial, got %d connections", server.connCount())
+	}
+
+	infos := pool.List()
+	if len(infos) != 1 || infos[0].Refs != len(clients) {
+		t.Errorf("Expected one connection used %d times, got %+v", len(clients), infos)
+	}
+
+	// A tunnel with other credentials gets its own connection
+	tun, _ := newTestTunnel(t, server)
+	tun.SetUser("admin")
+	client, err := pool.Get(tun)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client == clients[0] {
+		t.Errorf("Expected a separate connection for another user")
+	}
+
+	// The ssh-agent and the keyboard-interactive answers are part of the credentials
+	others := map[string]func(tun *SshTunnel){
+		"agent socket":     func(tun *SshTunnel) { tun.SetAgentSocket("/tmp/other-agent.sock") },
+		"agent identities": func(tun *SshTunnel) { tun.SetAgentIdentities("deploy") },
+		"responder": func(tun *SshTunnel) {
+			tun.SetKeyboardInteractiveResponder(StaticResponder("123456"))
+			tun.SetKeyboardInteractiveID("otp")
+		},
+	}
+	for name, configure := range others {
+		tun, _ := newTestTunnel(t, server)
+		configure(tun)
+		client, err := pool.Get(tun)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if client == clients[0] {
+			t.Errorf("Expected a separate connection for another %s", name)
+		}
+	}
+}
+
+func TestPoolGetKeyed(t *testing.T) {
+	server := newTestServer(t)
+	pool := newTestPool(t, time.Minute)
+
+	created := 0
+	newTun := func() (*SshTunnel, error) {
+		created++
+		tun, _ := newTestTunnel(t, server)
+		return tun, nil
+	}
+
+	client, err := pool.GetKeyed("options", newTun)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reused, err := pool.GetKeyed("options", newTun)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reused != client || created != 1 {
+		t.Errorf("Expected the tunnel to be created only when the pool misses, got %d tunnels", created)
+	}
+
+	// The connection is shared with tunnels opening the same connection
+	tun, _ := newTestTunnel(t, server)
+	shared, err := pool.Get(tun)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shared != client || server.connCount() != 1 {
+		t.Errorf("Expected the keyed connection to be shared with the tunnel")
+	}
+
+	pool.Invalidate(client)
+	_, err = pool.GetKeyed("options", newTun)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created != 2 {
+		t.Errorf("Expected the tunnel to be created again once the connection is gone")
+	}
+}
+
+func TestPoolRelease(t *testing.T) {
+	server := newTestServer(t)
+	pool := newTestPool(t, time.Millisecond)
+	tun, _ := newTestTunnel(t, server)
+
+	client, err := pool.Get(tun)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.Release(client)
+
+	// Released connections stay open until they're idle for too long
+	reused, err := pool.Get(tun)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reused != client {
+		t.Errorf("Expected the released connection to be reused")
+	}
+
+	time.Sleep(time.Millisecond * 5)
+	pool.healthCheck()
+	if len(pool.List()) != 1 {
+		t.Fatalf("Expected the connection in use to be kept")
+	}
+
+	pool.Release(reused)
+	time.Sleep(time.Millisecond * 5)
+	pool.healthCheck()
+	if len(pool.List()) != 0 {
+		t.Errorf("Expected the idle connection to be closed, got %+v", pool.List())
+	}
+	if _, _, err := client.SendRequest("keepalive@openssh.com", true, nil); err == nil {
+		t.Errorf("Expected the idle connection to be closed")
+	}
+}
+
+func TestPoolInvalidate(t *testing.T) {
+	server := newTestServer(t)
+	pool := newTestPool(t, time.Minute)
+	tun, _ := newTestTunnel(t, server)
+
+	client, err := pool.Get(tun)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.Invalidate(client)
+
+	if len(pool.List()) != 0 {
+		t.Errorf("Expected the connection to be removed, got %+v", pool.List())
+	}
+	if _, _, err := client.SendRequest("keepalive@openssh.com", true, nil); err == nil {
+		t.Errorf("Expected the connection to be closed")
+	}
+
+	newClient, err := pool.Get(tun)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newClient == client {
+		t.Errorf("Expected a new connection after the old one was invalidated")
+	}
+}
+
+func TestPoolKeepAliveStopsOnRelease(t *testing.T) {
+	server := newTestServer(t)
+	pool := newTestPool(t, time.Minute)
+	tun, _ := newTestTunnel(t, server)
+	tun.SetPool(pool)
+
+	// Every connection of the tunnel gets the same pooled client
+	for i := 0; i < 5; i++ {
+		_, err := tun.addConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		tun.removeConn()
+	}
+
+	if tun.keepAliveCancel != nil {
+		t.Errorf("Expected the keepalive to be stopped once the client is released")
+	}
+
+	time.Sleep(tun.keepAliveInterval * 2)
+	keepAlives := server.keepAlives.Load()
+	time.Sleep(tun.keepAliveInterval * 5)
+	if sent := server.keepAlives.Load() - keepAlives; sent != 0 {
+		t.Errorf("Expected no keepalives for the released client, got %d", sent)
+	}
+	if len(pool.List()) != 1 {
+		t.Errorf("Expected the client to stay in the pool")
+	}
+}
+
+func TestConcurrentDials(t *testing.T) {
+	server := newTestServer(t)
+	tun, _ := newTestTunnel(t, server)
+
+	// Every pool dials the shared tunnel, whose SSH config is initialized by the first of them
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		pool := newTestPool(t, time.Minute)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			_, err := pool.Get(tun)
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if server.connCount() != 8 {
+		t.Errorf("Expected a connection per pool, got %d", server.connCount())
+	}
+}
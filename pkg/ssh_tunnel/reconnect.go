@@ -0,0 +1,272 @@
+// Copyright 2024 Daytona Platforms Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package ssh_tunnel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SetKeepAlive changes how often keepalive requests are sent over the SSH connection and how many of them may go
+// unanswered before the connection is considered dead (defaults to every 30 seconds, 3 times).
+// A zero interval disables keepalives.
+func (tun *SshTunnel) SetKeepAlive(interval time.Duration, countMax int) {
+	tun.keepAliveInterval = interval
+	tun.keepAliveCountMax = countMax
+}
+
+// SetReconnectBackoff changes the exponential backoff used when the SSH connection has to be dialed again
+// (defaults to starting at 1 second, up to 30 seconds between attempts, giving up after 5 minutes).
+func (tun *SshTunnel) SetReconnectBackoff(initial time.Duration, max time.Duration, timeout time.Duration) {
+	tun.backoffInitial = initial
+	tun.backoffMax = max
+	tun.reconnectTimeout = timeout
+}
+
+// startKeepAlive starts the keepalive of the tunnel's SSH client, stopping the one of the previous client.
+// It must be called with the client mutex held.
+func (tun *SshTunnel) startKeepAlive(sshClient *ssh.Client) {
+	tun.stopKeepAlive()
+
+	ctx, cancel := context.WithCancel(tun.ctx)
+	tun.keepAliveCancel = cancel
+	go tun.keepAlive(ctx, sshClient)
+}
+
+// stopKeepAlive stops the keepalive once the tunnel gave its SSH client back. A pooled client stays open, so
+// without it every tunnel that used the client would keep watching it. It must be called with the client mutex held.
+func (tun *SshTunnel) stopKeepAlive() {
+	if tun.keepAliveCancel != nil {
+		tun.keepAliveCancel()
+		tun.keepAliveCancel = nil
+	}
+}
+
+// keepAlive sends keepalive requests until the SSH client is closed or ctx is done. If the client stops answering
+// or its connection drops while it's still in use by the tunnel, the tunnel reconnects.
+func (tun *SshTunnel) keepAlive(ctx context.Context, sshClient *ssh.Client) {
+	closed := tun.clientClosed(sshClient)
+
+	var tick <-chan time.Time
+	if tun.keepAliveInterval > 0 {
+		ticker := time.NewTicker(tun.keepAliveInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	missed := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-closed:
+			tun.reconnect(sshClient, fmt.Errorf("ssh connection to %s closed", sshClient.RemoteAddr()))
+			return
+		case <-tick:
+		}
+
+		err := sendKeepAlive(sshClient, tun.keepAliveInterval)
+		if err == nil {
+			missed = 0
+			continue
+		}
+
+		missed++
+		if missed >= tun.keepAliveCountMax {
+			tun.reconnect(sshClient, err)
+			return
+		}
+	}
+}
+
+func sendKeepAlive(sshClient *ssh.Client, timeout time.Duration) error {
+	errChan := make(chan error, 1)
+	go func() {
+		// Servers reply with a failure to unknown requests, any reply means the connection is alive
+		_, _, err := sshClient.SendRequest("keepalive@openssh.com", true, nil)
+		errChan <- err
+	}()
+
+	select {
+	case err := <-errChan:
+		return err
+	case <-time.After(timeout):
+		return fmt.Errorf("keepalive to %s timed out", sshClient.RemoteAddr())
+	}
+}
+
+// reconnect replaces a dead SSH client. Clients that the tunnel already closed or replaced are ignored.
+// The server is dialed again without holding the client mutex, so connections can still be added and removed
+// while the tunnel reconnects.
+func (tun *SshTunnel) reconnect(deadClient *ssh.Client, reason error) {
+	tun.clientMutex.Lock()
+	if tun.SshClient != deadClient {
+		tun.clientMutex.Unlock()
+		return
+	}
+
+	tun.SshClient = nil
+	tun.stopKeepAlive()
+	tun.discard(deadClient)
+	tun.clientMutex.Unlock()
+
+	if tun.reverse {
+		// Closing the client makes the remote listener fail, startReverse takes care of reconnecting
+		return
+	}
+
+	tun.tunneledState(&TunneledConnectionState{
+		From:  tun.Server.String(),
+		Info:  "ssh connection lost, reconnecting",
+		Error: reason,
+	})
+	tun.setConnState(StateReconnecting)
+
+	sshClient, err := tun.redial(reason)
+	if err != nil {
+		tun.tunneledState(&TunneledConnectionState{
+			From:  tun.Server.String(),
+			Error: err,
+		})
+		return
+	}
+
+	tun.clientMutex.Lock()
+	// A new connection may have dialed its own client in the meantime, or all connections may be gone
+	if tun.SshClient != nil || tun.active == 0 {
+		tun.release(sshClient)
+	} else {
+		tun.SshClient = sshClient
+		tun.startKeepAlive(sshClient)
+	}
+	tun.clientMutex.Unlock()
+
+	tun.setConnState(StateStarted)
+}
+
+// dialWithBackoff dials the server. If it fails because of the network the tunnel transitions to
+// StateReconnecting and keeps retrying.
+func (tun *SshTunnel) dialWithBackoff() (*ssh.Client, error) {
+	sshClient, err := tun.acquire()
+	if err == nil {
+		return sshClient, nil
+	}
+
+	if !isRetryable(err) {
+		return nil, err
+	}
+
+	tun.setConnState(StateReconnecting)
+
+	sshClient, err = tun.redial(err)
+	if err != nil {
+		return nil, err
+	}
+
+	tun.setConnState(StateStarted)
+	return sshClient, nil
+}
+
+// redial retries dialing the server with exponential backoff until it succeeds, the error can't be recovered
+// from, the reconnect timeout is exceeded or the tunnel is stopped.
+func (tun *SshTunnel) redial(lastErr error) (*ssh.Client, error) {
+	deadline := time.Now().Add(tun.reconnectTimeout)
+	backoff := tun.backoffInitial
+
+	for {
+		if time.Now().Add(backoff).After(deadline) {
+			return nil, fmt.Errorf("reconnecting to %s timed out after %s: %w", tun.Server.String(), tun.reconnectTimeout, lastErr)
+		}
+
+		select {
+		case <-tun.ctx.Done():
+			return nil, tun.ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		sshClient, err := tun.acquire()
+		if err == nil {
+			return sshClient, nil
+		}
+
+		if !isRetryable(err) {
+			return nil, err
+		}
+		lastErr = err
+
+		backoff *= 2
+		if backoff > tun.backoffMax {
+			backoff = tun.backoffMax
+		}
+	}
+}
+
+// acquire returns a SSH client for the tunnel, from the pool if one is set.
+func (tun *SshTunnel) acquire() (*ssh.Client, error) {
+	if tun.pool != nil {
+		return tun.pool.Get(tun)
+	}
+	return tun.Dial()
+}
+
+// clientClosed returns a channel that is closed once the SSH client's connection is closed. Pooled clients are
+// already waited on by the pool.
+func (tun *SshTunnel) clientClosed(sshClient *ssh.Client) <-chan struct{} {
+	if tun.pool != nil {
+		if closed := tun.pool.clientClosed(sshClient); closed != nil {
+			return closed
+		}
+	}
+
+	// The other clients are closed when the tunnel releases them, which ends the wait
+	closed := make(chan struct{})
+	go func() {
+		sshClient.Wait()
+		close(closed)
+	}()
+	return closed
+}
+
+// release gives back a SSH client the tunnel doesn't need anymore.
+func (tun *SshTunnel) release(sshClient *ssh.Client) {
+	if tun.pool != nil {
+		tun.pool.Release(sshClient)
+		return
+	}
+	sshClient.Close()
+}
+
+// discard closes a broken SSH client so it isn't handed out again.
+func (tun *SshTunnel) discard(sshClient *ssh.Client) {
+	if tun.pool != nil {
+		tun.pool.Invalidate(sshClient)
+		return
+	}
+	sshClient.Close()
+}
+
+func (tun *SshTunnel) setConnState(state ConnectionState) {
+	if tun.connState != nil {
+		tun.connState(tun, state)
+	}
+}
+
+// isRetryable reports whether dialing the server again may succeed. Network failures are retried while
+// authentication and host key errors are not.
+func isRetryable(err error) bool {
+	var mismatchErr *HostKeyMismatchError
+	var unknownErr *HostKeyUnknownError
+	if errors.As(err, &mismatchErr) || errors.As(err, &unknownErr) {
+		return false
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
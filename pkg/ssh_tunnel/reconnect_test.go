@@ -0,0 +1,326 @@
+package ssh_tunnel
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const testPassword = "secret"
+
+// testServer is an in-process SSH server accepting testPassword and rejecting all public keys. It answers
+// keepalive requests and rejects all channels.
+type testServer struct {
+	listener net.Listener
+	config   *ssh.ServerConfig
+	mutex    sync.Mutex
+	conns    []net.Conn
+	// attempts records the authentication methods and keys the clients tried
+	attempts []string
+	// reject closes new connections before the handshake
+	reject atomic.Bool
+	// mute stops answering keepalive requests
+	mute atomic.Bool
+	// passwordOnly stops offering publickey authentication to new connections
+	passwordOnly atomic.Bool
+	keepAlives   atomic.Int32
+}
+
+func newTestServer(t *testing.T) *testServer {
+	// Keeps the default keys and known hosts of the user out of the tests
+	t.Setenv("HOME", t.TempDir())
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostKey, err := ssh.NewSignerFromKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &testServer{listener: listener}
+	server.config = &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			server.recordAttempt("password")
+			if string(password) != testPassword {
+				return nil, ssh.ErrNoAuth
+			}
+			return nil, nil
+		},
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			server.recordAttempt("publickey " + ssh.FingerprintSHA256(key))
+			return nil, ssh.ErrNoAuth
+		},
+	}
+	server.config.AddHostKey(hostKey)
+	t.Cleanup(func() {
+		listener.Close()
+		server.dropConns()
+	})
+
+	go server.serve()
+
+	return server
+}
+
+func (s *testServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		if s.reject.Load() {
+			conn.Close()
+			continue
+		}
+
+		s.mutex.Lock()
+		s.conns = append(s.conns, conn)
+		s.mutex.Unlock()
+
+		go s.handle(conn)
+	}
+}
+
+func (s *testServer) handle(conn net.Conn) {
+	config := s.config
+	if s.passwordOnly.Load() {
+		passwordOnly := *s.config
+		passwordOnly.PublicKeyCallback = nil
+		config = &passwordOnly
+	}
+
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	go func() {
+		for newChan := range chans {
+			newChan.Reject(ssh.Prohibited, "no channels")
+		}
+	}()
+
+	for req := range reqs {
+		if req.Type == "keepalive@openssh.com" {
+			s.keepAlives.Add(1)
+		}
+		if s.mute.Load() {
+			continue
+		}
+		req.Reply(false, nil)
+	}
+}
+
+func (s *testServer) recordAttempt(attempt string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.attempts = append(s.attempts, attempt)
+}
+
+// dropConns closes the open connections, as a restarted server or a network failure would
+func (s *testServer) dropConns() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+}
+
+func (s *testServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+// newTestTunnel returns a started tunnel without endpoints, connections are added with addConn
+func newTestTunnel(t *testing.T, server *testServer) (*SshTunnel, chan ConnectionState) {
+	tun := NewDialer("127.0.0.1")
+	tun.SetPort(server.port())
+	tun.SetPassword(testPassword)
+	tun.SetExclusiveAuth(true)
+	tun.SetHostKeyPolicy(HostKeyPolicyInsecure)
+	tun.SetKeepAlive(time.Millisecond*20, 2)
+	tun.SetReconnectBackoff(time.Millisecond*10, time.Millisecond*20, time.Second*5)
+
+	states := make(chan ConnectionState, 16)
+	tun.SetConnState(func(_ *SshTunnel, state ConnectionState) {
+		states <- state
+	})
+
+	tun.ctx, tun.cancel = context.WithCancel(context.Background())
+	t.Cleanup(tun.cancel)
+
+	return tun, states
+}
+
+func waitForState(t *testing.T, states chan ConnectionState, expected ConnectionState) {
+	t.Helper()
+
+	timeout := time.After(time.Second * 5)
+	for {
+		select {
+		case state := <-states:
+			if state == expected {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("Timed out waiting for state %d", expected)
+		}
+	}
+}
+
+func (tun *SshTunnel) currentClient() *ssh.Client {
+	tun.clientMutex.Lock()
+	defer tun.clientMutex.Unlock()
+
+	return tun.SshClient
+}
+
+func TestReconnect(t *testing.T) {
+	server := newTestServer(t)
+	tun, states := newTestTunnel(t, server)
+
+	deadClient, err := tun.addConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server.reject.Store(true)
+	server.dropConns()
+	waitForState(t, states, StateReconnecting)
+
+	// The server is dialed again without holding the client mutex
+	if !tun.clientMutex.TryLock() {
+		t.Fatal("Expected the client mutex to be free while reconnecting")
+	}
+	tun.clientMutex.Unlock()
+
+	server.reject.Store(false)
+	waitForState(t, states, StateStarted)
+
+	sshClient := tun.currentClient()
+	if sshClient == nil || sshClient == deadClient {
+		t.Fatalf("Expected a new SSH client, got %v", sshClient)
+	}
+}
+
+func TestReconnectWithoutConnections(t *testing.T) {
+	server := newTestServer(t)
+	tun, states := newTestTunnel(t, server)
+
+	_, err := tun.addConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server.reject.Store(true)
+	server.dropConns()
+	waitForState(t, states, StateReconnecting)
+
+	// The last connection goes away while the tunnel reconnects
+	tun.removeConn()
+
+	server.reject.Store(false)
+	waitForState(t, states, StateStarted)
+
+	if sshClient := tun.currentClient(); sshClient != nil {
+		t.Errorf("Expected the new SSH client to be released without connections")
+	}
+}
+
+func TestKeepAlive(t *testing.T) {
+	server := newTestServer(t)
+	tun, states := newTestTunnel(t, server)
+
+	deadClient, err := tun.addConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server.mute.Store(true)
+	waitForState(t, states, StateReconnecting)
+	if server.keepAlives.Load() == 0 {
+		t.Errorf("Expected a keepalive to be sent")
+	}
+
+	server.mute.Store(false)
+	waitForState(t, states, StateStarted)
+
+	sshClient := tun.currentClient()
+	if sshClient == nil || sshClient == deadClient {
+		t.Fatalf("Expected the unresponsive SSH client to be replaced, got %v", sshClient)
+	}
+}
+
+func TestAddConnDialsWithoutLock(t *testing.T) {
+	server := newTestServer(t)
+	tun, states := newTestTunnel(t, server)
+
+	_, err := tun.addConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server.reject.Store(true)
+	server.dropConns()
+	waitForState(t, states, StateReconnecting)
+
+	// A new connection dials the server while the tunnel reconnects, both keep failing until the server accepts
+	added := make(chan *ssh.Client, 1)
+	go func() {
+		sshClient, err := tun.addConn()
+		if err != nil {
+			t.Error(err)
+		}
+		added <- sshClient
+	}()
+	time.Sleep(time.Millisecond * 50)
+
+	removed := make(chan struct{})
+	go func() {
+		tun.removeConn()
+		close(removed)
+	}()
+	select {
+	case <-removed:
+	case <-time.After(time.Second):
+		t.Fatal("Expected removeConn not to wait for the dial")
+	}
+
+	server.reject.Store(false)
+
+	var sshClient *ssh.Client
+	select {
+	case sshClient = <-added:
+	case <-time.After(time.Second * 5):
+		t.Fatal("Timed out waiting for addConn")
+	}
+
+	// Whichever dial finishes last is released, the connection uses the installed client
+	time.Sleep(time.Millisecond * 100)
+	if sshClient == nil || sshClient != tun.currentClient() {
+		t.Errorf("Expected the connection to use the installed SSH client")
+	}
+	tun.clientMutex.Lock()
+	active := tun.active
+	tun.clientMutex.Unlock()
+	if active != 1 {
+		t.Errorf("Expected 1 active connection, got %d", active)
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2024 Daytona Platforms Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package ssh_tunnel
+
+import (
+	"fmt"
+	"net"
+)
+
+// NewRemote creates a new SSH tunnel that listens on a port on the remote host and redirects the connections to a
+// port on local localhost (like `ssh -R`).
+// The remote host listens on localhost by default, use SetRemoteHost to bind a different address. Note that binding
+// anything other than localhost requires `GatewayPorts` to be enabled on the SSH server.
+// All the other settings work the same as in New.
+func NewRemote(remotePort int, server string, localPort int) *SshTunnel {
+	sshTun := New(localPort, server, remotePort)
+	sshTun.reverse = true
+	return sshTun
+}
+
+// NewRemoteUnix does the same as NewRemote but using unix sockets.
+func NewRemoteUnix(remoteUnixSocket string, server string, localUnixSocket string) *SshTunnel {
+	sshTun := NewUnix(localUnixSocket, server, remoteUnixSocket)
+	sshTun.reverse = true
+	return sshTun
+}
+
+// SetReverse changes the direction of the tunnel. A reverse tunnel listens on the remote endpoint and redirects
+// the connections to the local endpoint.
+func (tun *SshTunnel) SetReverse(reverse bool) {
+	tun.reverse = reverse
+}
+
+// startReverse keeps a SSH connection open with a listener on the remote endpoint. If the connection is lost, the
+// connection and the remote listener are established again.
+func (tun *SshTunnel) startReverse() error {
+	for {
+		sshClient, err := tun.acquire()
+		if err != nil {
+			if !isRetryable(err) {
+				return err
+			}
+			tun.setConnState(StateReconnecting)
+			sshClient, err = tun.redial(err)
+			if err != nil {
+				return err
+			}
+		}
+
+		remoteListener, err := sshClient.Listen(tun.remote.Type(), tun.remote.String())
+		if err != nil {
+			tun.release(sshClient)
+			return fmt.Errorf("remote listen %s on %s failed: %w", tun.remote.Type(), tun.remote.String(), err)
+		}
+
+		tun.clientMutex.Lock()
+		tun.SshClient = sshClient
+		tun.startKeepAlive(sshClient)
+		tun.clientMutex.Unlock()
+		tun.setConnState(StateStarted)
+
+		done := make(chan struct{})
+		go func() {
+			select {
+			case <-tun.ctx.Done():
+				// Closing the client also ends the forwarded connections. A pooled client is shared, so only
+				// the listener is closed
+				if tun.pool == nil {
+					sshClient.Close()
+				}
+			case <-done:
+			}
+		}()
+
+		err = tun.listen(remoteListener, func(remoteConn net.Conn) error {
+			tun.forwardReverse(remoteConn)
+			return nil
+		})
+		close(done)
+
+		tun.clientMutex.Lock()
+		if tun.SshClient == sshClient {
+			tun.SshClient = nil
+			tun.stopKeepAlive()
+		}
+		tun.clientMutex.Unlock()
+
+		select {
+		case <-tun.ctx.Done():
+			tun.release(sshClient)
+			return nil
+		default:
+		}
+
+		tun.discard(sshClient)
+
+		tun.tunneledState(&TunneledConnectionState{
+			From:  tun.Server.String(),
+			Info:  "ssh connection lost, reconnecting",
+			Error: err,
+		})
+		tun.setConnState(StateReconnecting)
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright 2024 Daytona Platforms Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package ssh_tunnel
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	socksVersion5 = 0x05
+
+	socksAuthNone         = 0x00
+	socksAuthNoAcceptable = 0xff
+
+	socksCmdConnect = 0x01
+
+	socksAddrIPv4   = 0x01
+	socksAddrDomain = 0x03
+	socksAddrIPv6   = 0x04
+
+	socksReplySucceeded               = 0x00
+	socksReplyHostUnreachable         = 0x04
+	socksReplyCommandNotSupported     = 0x07
+	socksReplyAddressTypeNotSupported = 0x08
+)
+
+var errSocksUnsupportedCommand = errors.New("unsupported SOCKS command")
+var errSocksUnsupportedAddressType = errors.New("unsupported SOCKS address type")
+
+// NewDynamic creates a new SSH tunnel that runs a SOCKS5 proxy on a port on local localhost (like `ssh -D`).
+// Every destination requested through the proxy is dialed from the server.
+// Only the CONNECT command without authentication is supported.
+// All the other settings work the same as in New.
+func NewDynamic(localPort int, server string) *SshTunnel {
+	sshTun := defaultSSHTun(server)
+	sshTun.local = NewTCPEndpoint("localhost", localPort)
+	sshTun.dynamic = true
+	return sshTun
+}
+
+// forwardDynamic negotiates a SOCKS5 connection and forwards it to the requested destination through the server.
+func (tun *SshTunnel) forwardDynamic(localConn net.Conn, sshClient *ssh.Client) {
+	from := localConn.RemoteAddr().String()
+
+	tun.tunneledState(&TunneledConnectionState{
+		From: from,
+		Info: fmt.Sprintf("accepted %s SOCKS connection", tun.local.Type()),
+	})
+
+	destination, err := readSocksRequest(localConn)
+	if err != nil {
+		switch {
+		case errors.Is(err, errSocksUnsupportedCommand):
+			writeSocksReply(localConn, socksReplyCommandNotSupported)
+		case errors.Is(err, errSocksUnsupportedAddressType):
+			writeSocksReply(localConn, socksReplyAddressTypeNotSupported)
+		}
+
+		tun.tunneledState(&TunneledConnectionState{
+			From:  from,
+			Error: fmt.Errorf("SOCKS handshake failed: %w", err),
+		})
+
+		localConn.Close()
+		return
+	}
+
+	remoteConn, err := sshClient.Dial("tcp", destination)
+	if err != nil {
+		writeSocksReply(localConn, socksReplyHostUnreachable)
+
+		tun.tunneledState(&TunneledConnectionState{
+			From:  from,
+			Error: fmt.Errorf("remote dial tcp to %s failed: %w", destination, err),
+		})
+
+		localConn.Close()
+		return
+	}
+
+	err = writeSocksReply(localConn, socksReplySucceeded)
+	if err != nil {
+		tun.tunneledState(&TunneledConnectionState{
+			From:  from,
+			Error: fmt.Errorf("SOCKS reply failed: %w", err),
+		})
+
+		remoteConn.Close()
+		localConn.Close()
+		return
+	}
+
+	connStr := fmt.Sprintf("%s -(%s)> %s -(ssh)> %s -(tcp)> %s", from, tun.local.Type(), tun.local.String(),
+		tun.Server.String(), destination)
+
+	tun.pipe(from, localConn, remoteConn, connStr)
+}
+
+// readSocksRequest reads the SOCKS5 method negotiation and the request and returns the requested destination.
+func readSocksRequest(conn io.ReadWriter) (string, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return "", err
+	}
+	if header[0] != socksVersion5 {
+		return "", fmt.Errorf("unsupported SOCKS version %d", header[0])
+	}
+
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return "", err
+	}
+
+	noAuth := false
+	for _, method := range methods {
+		if method == socksAuthNone {
+			noAuth = true
+			break
+		}
+	}
+	if !noAuth {
+		conn.Write([]byte{socksVersion5, socksAuthNoAcceptable})
+		return "", errors.New("no acceptable SOCKS authentication method")
+	}
+	if _, err := conn.Write([]byte{socksVersion5, socksAuthNone}); err != nil {
+		return "", err
+	}
+
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(conn, request); err != nil {
+		return "", err
+	}
+	if request[0] != socksVersion5 {
+		return "", fmt.Errorf("unsupported SOCKS version %d", request[0])
+	}
+	if request[1] != socksCmdConnect {
+		return "", fmt.Errorf("%w: %d", errSocksUnsupportedCommand, request[1])
+	}
+
+	var host string
+	switch request[3] {
+	case socksAddrIPv4:
+		addr := make([]byte, net.IPv4len)
+		if _, err := io.ReadFull(conn, addr); err != nil {
+			return "", err
+		}
+		host = net.IP(addr).String()
+	case socksAddrIPv6:
+		addr := make([]byte, net.IPv6len)
+		if _, err := io.ReadFull(conn, addr); err != nil {
+			return "", err
+		}
+		host = net.IP(addr).String()
+	case socksAddrDomain:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return "", err
+		}
+		domain := make([]byte, length[0])
+		if _, err := io.ReadFull(conn, domain); err != nil {
+			return "", err
+		}
+		host = string(domain)
+	default:
+		return "", fmt.Errorf("%w: %d", errSocksUnsupportedAddressType, request[3])
+	}
+
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return "", err
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), nil
+}
+
+// writeSocksReply writes a SOCKS5 reply. The bound address is always reported as 0.0.0.0:0 since the connection
+// is made from the server.
+func writeSocksReply(conn io.Writer, reply byte) error {
+	_, err := conn.Write([]byte{socksVersion5, reply, 0x00, socksAddrIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
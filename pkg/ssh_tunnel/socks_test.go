@@ -0,0 +1,74 @@
+package ssh_tunnel
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestReadSocksRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		request  []byte
+		expected string
+	}{
+		{
+			name:     "ipv4",
+			request:  []byte{0x05, 0x01, 0x00, 0x05, 0x01, 0x00, 0x01, 172, 17, 0, 2, 0x1f, 0x90},
+			expected: "172.17.0.2:8080",
+		},
+		{
+			name:     "domain",
+			request:  append(append([]byte{0x05, 0x01, 0x00, 0x05, 0x01, 0x00, 0x03, 9}, []byte("localhost")...), 0x00, 0x16),
+			expected: "localhost:22",
+		},
+		{
+			name:     "ipv6",
+			request:  append(append([]byte{0x05, 0x01, 0x00, 0x05, 0x01, 0x00, 0x04}, net.IPv6loopback...), 0x01, 0xbb),
+			expected: "[::1]:443",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conn := &bufferConn{in: bytes.NewBuffer(test.request)}
+
+			destination, err := readSocksRequest(conn)
+			if err != nil {
+				t.Fatalf("Error reading SOCKS request: %s", err)
+			}
+
+			if destination != test.expected {
+				t.Errorf("Expected destination %s, got %s", test.expected, destination)
+			}
+
+			if !bytes.Equal(conn.out.Bytes(), []byte{0x05, 0x00}) {
+				t.Errorf("Expected no authentication to be selected, got %v", conn.out.Bytes())
+			}
+		})
+	}
+}
+
+func TestReadSocksRequestUnsupportedCommand(t *testing.T) {
+	// BIND is not supported
+	conn := &bufferConn{in: bytes.NewBuffer([]byte{0x05, 0x01, 0x00, 0x05, 0x02, 0x00, 0x01, 127, 0, 0, 1, 0x00, 0x50})}
+
+	_, err := readSocksRequest(conn)
+	if !errors.Is(err, errSocksUnsupportedCommand) {
+		t.Errorf("Expected unsupported command error, got %v", err)
+	}
+}
+
+type bufferConn struct {
+	in  *bytes.Buffer
+	out bytes.Buffer
+}
+
+func (c *bufferConn) Read(p []byte) (int, error) {
+	return c.in.Read(p)
+}
+
+func (c *bufferConn) Write(p []byte) (int, error) {
+	return c.out.Write(p)
+}
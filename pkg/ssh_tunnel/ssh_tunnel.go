@@ -12,12 +12,16 @@ import (
 	"time"
 
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
 	"golang.org/x/sync/errgroup"
 )
 
 // SshTunnel represents a SSH tunnel
 type SshTunnel struct {
 	mutex             *sync.Mutex
+	clientMutex       *sync.Mutex
+	dialMutex         *sync.Mutex
+	configMutex       *sync.Mutex
 	ctx               context.Context
 	cancel            context.CancelFunc
 	started           bool
@@ -25,7 +29,35 @@ type SshTunnel struct {
 	authType          AuthType
 	authKeyFile       string
 	authKeyReader     io.Reader
+	authCertFile      string
 	authPassword      string
+	kbdResponder      KeyboardInteractiveResponder
+	kbdResponderID    string
+	keyFingerprints   []string
+	hostKeyPolicy     HostKeyPolicy
+	knownHostsFiles   []string
+	managedKnownHosts string
+	jumpHosts         []*SshTunnel
+	identitiesOnly    bool
+	exclusiveAuth     bool
+	agentSock         string
+	agentMutex        *sync.Mutex
+	agentConn         net.Conn
+	agentConnSock     string
+	agent             agent.ExtendedAgent
+	agentIdentities   []string
+	agentKeyNames     map[string]string
+	agentOffered      []string
+	lastAuthAttempt   string
+	keepAliveInterval time.Duration
+	keepAliveCountMax int
+	keepAliveCancel   context.CancelFunc
+	backoffInitial    time.Duration
+	backoffMax        time.Duration
+	reconnectTimeout  time.Duration
+	reverse           bool
+	dynamic           bool
+	pool              *Pool
 	Server            *Endpoint
 	local             *Endpoint
 	remote            *Endpoint
@@ -51,6 +83,10 @@ const (
 	// StateStarted represents a tunnel ready to accept connections.
 	// A call to stop or an error will make the state to transition to StateStopped.
 	StateStarted
+
+	// StateReconnecting represents a tunnel that lost its SSH connection and is dialing the server again.
+	// The local listener stays open, a successful reconnect will make the state to transition back to StateStarted.
+	StateReconnecting
 )
 
 // New creates a new SSH tunnel to the specified server redirecting a port on local localhost to a port on remote localhost.
@@ -77,13 +113,30 @@ func NewUnix(localUnixSocket string, server string, remoteUnixSocket string) *Ss
 	return sshTun
 }
 
+// NewDialer creates a SSH tunnel without endpoints. It is only meant to be used to Dial the server with the
+// same settings a tunnel would use.
+func NewDialer(server string) *SshTunnel {
+	return defaultSSHTun(server)
+}
+
 func defaultSSHTun(server string) *SshTunnel {
 	return &SshTunnel{
-		mutex:    &sync.Mutex{},
-		Server:   NewTCPEndpoint(server, 22),
-		user:     "root",
-		authType: AuthTypeAuto,
-		timeout:  time.Second * 15,
+		mutex:             &sync.Mutex{},
+		clientMutex:       &sync.Mutex{},
+		dialMutex:         &sync.Mutex{},
+		configMutex:       &sync.Mutex{},
+		agentMutex:        &sync.Mutex{},
+		Server:            NewTCPEndpoint(server, 22),
+		user:              "root",
+		authType:          AuthTypeAuto,
+		hostKeyPolicy:     HostKeyPolicyStrict,
+		knownHostsFiles:   defaultKnownHostsFiles(),
+		timeout:           time.Second * 15,
+		keepAliveInterval: time.Second * 30,
+		keepAliveCountMax: 3,
+		backoffInitial:    time.Second,
+		backoffMax:        time.Second * 30,
+		reconnectTimeout:  time.Minute * 5,
 	}
 }
 
@@ -138,6 +191,40 @@ func (tun *SshTunnel) SetPassword(password string) {
 	tun.authPassword = password
 }
 
+// SetHostKeyPolicy changes how the host key of the server is verified (defaults to HostKeyPolicyStrict).
+func (tun *SshTunnel) SetHostKeyPolicy(policy HostKeyPolicy) {
+	tun.hostKeyPolicy = policy
+}
+
+// SetKnownHostsFiles sets the known hosts files the host key is checked against (defaults to `~/.ssh/known_hosts`).
+// Files that don't exist are ignored.
+func (tun *SshTunnel) SetKnownHostsFiles(files ...string) {
+	tun.knownHostsFiles = files
+}
+
+// SetManagedKnownHostsFile sets a known hosts file owned by the caller. It is checked along with the other
+// known hosts files and, with HostKeyPolicyTrustOnFirstUse, new host keys are recorded in it.
+func (tun *SshTunnel) SetManagedKnownHostsFile(file string) {
+	tun.managedKnownHosts = file
+}
+
+// SetIdentitiesOnly restricts key-based authentication to the configured key file. By default the keys
+// from the ssh-agent are offered as well if the key file is rejected.
+func (tun *SshTunnel) SetIdentitiesOnly(identitiesOnly bool) {
+	tun.identitiesOnly = identitiesOnly
+}
+
+// SetExclusiveAuth restricts authentication to the configured auth type. The default keys and the keys from the
+// ssh-agent are not offered unless the auth type uses them, keyboard-interactive is still used if a responder is set.
+func (tun *SshTunnel) SetExclusiveAuth(exclusiveAuth bool) {
+	tun.exclusiveAuth = exclusiveAuth
+}
+
+// SetPool makes the tunnel take its SSH connections from the pool instead of dialing its own.
+func (tun *SshTunnel) SetPool(pool *Pool) {
+	tun.pool = pool
+}
+
 // SetLocalHost sets the local host to redirect (defaults to localhost).
 func (tun *SshTunnel) SetLocalHost(host string) {
 	tun.local.host = host
@@ -178,9 +265,10 @@ func (tun *SshTunnel) SetTunneledConnState(tunneledConnStateFun func(*SshTunnel,
 // Start starts the SSH tunnel. It can be stopped by calling `Stop` or cancelling its context.
 // This call will block until the tunnel is stopped either calling those methods or by an error.
 // Note on SSH authentication: in case the tunnel's authType is set to AuthTypeAuto the following will happen:
-// The default key files will be used, if that doesn't succeed it will try to use the SSH server.
-// If that fails the whole authentication fails.
+// All the default key files that can be read are offered to the server, followed by the keys of the SSH server.
+// If the server accepts none of them the whole authentication fails.
 // That means if you want to use password or encrypted key file authentication, you have to specify that explicitly.
+// With password authentication only the password is tried, with the password and keyboard-interactive methods.
 func (tun *SshTunnel) Start(ctx context.Context) error {
 	tun.mutex.Lock()
 	if tun.started {
@@ -195,11 +283,19 @@ func (tun *SshTunnel) Start(ctx context.Context) error {
 		tun.connState(tun, StateStarting)
 	}
 
+	tun.configMutex.Lock()
 	config, err := tun.InitSSHConfig()
+	if err == nil {
+		tun.SshConfig = config
+	}
+	tun.configMutex.Unlock()
 	if err != nil {
 		return tun.stop(fmt.Errorf("ssh config failed: %w", err))
 	}
-	tun.SshConfig = config
+
+	if tun.reverse {
+		return tun.stop(tun.startReverse())
+	}
 
 	listenConfig := net.ListenConfig{}
 	localListener, err := listenConfig.Listen(tun.ctx, tun.local.Type(), tun.local.String())
@@ -209,7 +305,7 @@ func (tun *SshTunnel) Start(ctx context.Context) error {
 
 	errChan := make(chan error)
 	go func() {
-		errChan <- tun.listen(localListener)
+		errChan <- tun.listen(localListener, tun.handle)
 	}()
 
 	if tun.connState != nil {
@@ -219,64 +315,148 @@ func (tun *SshTunnel) Start(ctx context.Context) error {
 	return tun.stop(<-errChan)
 }
 
-// Stop closes all connections and makes Start exit gracefuly.
+// Stop closes all connections and makes Start exit gracefuly. The connection to the ssh-agent is closed as well,
+// so dialers that were never started should be stopped once they aren't needed anymore.
 func (tun *SshTunnel) Stop() {
 	tun.mutex.Lock()
-	defer tun.mutex.Unlock()
-
 	if tun.started {
 		tun.cancel()
 	}
+	tun.mutex.Unlock()
+
+	tun.closeAgent()
 }
 
+// InitSSHConfig builds the SSH client configuration from the tunnel's authentication and host key settings.
 func (tun *SshTunnel) InitSSHConfig() (*ssh.ClientConfig, error) {
+	tun.keyFingerprints = nil
+
+	hostKeyCallback, hostKeyAlgorithms, err := tun.hostKeyCallback()
+	if err != nil {
+		return nil, err
+	}
+
 	config := &ssh.ClientConfig{
-		User: tun.user,
-		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
-			return nil
-		},
-		Timeout: tun.timeout,
+		User:              tun.user,
+		HostKeyCallback:   hostKeyCallback,
+		HostKeyAlgorithms: hostKeyAlgorithms,
+		Timeout:           tun.timeout,
 	}
 
-	authMethod, err := tun.getSSHAuthMethod()
+	authMethods, err := tun.getSSHAuthMethods()
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %w", ErrAuthFailed, err)
 	}
 
-	config.Auth = []ssh.AuthMethod{authMethod}
+	config.Auth = authMethods
 
 	return config, nil
 }
 
+// sshConfig returns the SSH config of the tunnel, initializing it if Start wasn't called yet. The config is only
+// initialized once, concurrent dials and pool lookups of the tunnel share it.
+func (tun *SshTunnel) sshConfig() (*ssh.ClientConfig, error) {
+	tun.configMutex.Lock()
+	defer tun.configMutex.Unlock()
+
+	if tun.SshConfig == nil {
+		config, err := tun.InitSSHConfig()
+		if err != nil {
+			return nil, err
+		}
+		tun.SshConfig = config
+	}
+
+	return tun.SshConfig, nil
+}
+
+// Dial opens a new SSH connection to the tunnel's server, going through the jump hosts if any are set.
+// The SSH config is initialized if Start wasn't called yet.
+func (tun *SshTunnel) Dial() (*ssh.Client, error) {
+	if len(tun.jumpHosts) > 0 {
+		return tun.dialThroughJumpHosts()
+	}
+
+	return tun.dialVia(nil)
+}
+
+// dialVia opens a SSH connection to the tunnel's server. If via is not nil, the connection is made through it.
+// The handshakes of a tunnel are serialized since they record the auth attempts on the tunnel.
+func (tun *SshTunnel) dialVia(via *ssh.Client) (*ssh.Client, error) {
+	tun.dialMutex.Lock()
+	defer tun.dialMutex.Unlock()
+
+	config, err := tun.sshConfig()
+	if err != nil {
+		return nil, &DialError{Host: tun.Server.String(), Err: fmt.Errorf("ssh config failed: %w", err)}
+	}
+
+	tun.lastAuthAttempt = ""
+	tun.resetAgentOffered()
+
+	if via == nil {
+		sshClient, err := ssh.Dial(tun.Server.Type(), tun.Server.String(), config)
+		tun.authResult(err == nil)
+		if err != nil {
+			return nil, &DialError{
+				Host: tun.Server.String(),
+				Err:  fmt.Errorf("ssh dial %s to %s failed: %w", tun.Server.Type(), tun.Server.String(), tun.withAgentDetails(err)),
+			}
+		}
+		return sshClient, nil
+	}
+
+	conn, err := via.Dial(tun.Server.Type(), tun.Server.String())
+	if err != nil {
+		return nil, &DialError{
+			Host: tun.Server.String(),
+			Err:  fmt.Errorf("dial %s to %s through %s failed: %w", tun.Server.Type(), tun.Server.String(), via.RemoteAddr(), err),
+		}
+	}
+
+	clientConn, chans, reqs, err := ssh.NewClientConn(conn, tun.Server.String(), config)
+	tun.authResult(err == nil)
+	if err != nil {
+		conn.Close()
+		return nil, &DialError{
+			Host: tun.Server.String(),
+			Err:  fmt.Errorf("ssh handshake with %s through %s failed: %w", tun.Server.String(), via.RemoteAddr(), tun.withAgentDetails(err)),
+		}
+	}
+
+	return ssh.NewClient(clientConn, chans, reqs), nil
+}
+
 func (tun *SshTunnel) stop(err error) error {
 	tun.mutex.Lock()
 	tun.started = false
 	tun.mutex.Unlock()
+	tun.closeAgent()
 	if tun.connState != nil {
 		tun.connState(tun, StateStopped)
 	}
 	return err
 }
 
-func (tun *SshTunnel) listen(localListener net.Listener) error {
+func (tun *SshTunnel) listen(listener net.Listener, handle func(net.Conn) error) error {
 	errGroup, groupCtx := errgroup.WithContext(tun.ctx)
 
 	errGroup.Go(func() error {
 		for {
-			localConn, err := localListener.Accept()
+			conn, err := listener.Accept()
 			if err != nil {
-				return fmt.Errorf("local accept %s on %s failed: %w", tun.local.Type(), tun.local.String(), err)
+				return fmt.Errorf("accept %s on %s failed: %w", listener.Addr().Network(), listener.Addr().String(), err)
 			}
 
 			errGroup.Go(func() error {
-				return tun.handle(localConn)
+				return handle(conn)
 			})
 		}
 	})
 
 	<-groupCtx.Done()
 
-	localListener.Close()
+	listener.Close()
 
 	err := errGroup.Wait()
 
@@ -290,42 +470,73 @@ func (tun *SshTunnel) listen(localListener net.Listener) error {
 }
 
 func (tun *SshTunnel) handle(localConn net.Conn) error {
-	err := tun.addConn()
+	sshClient, err := tun.addConn()
 	if err != nil {
+		localConn.Close()
+		if isRetryable(err) {
+			// The tunnel keeps listening, the next connection will try to reconnect again
+			tun.tunneledState(&TunneledConnectionState{
+				From:  localConn.RemoteAddr().String(),
+				Error: err,
+			})
+			return nil
+		}
 		return err
 	}
 
-	tun.forward(localConn)
+	if tun.dynamic {
+		tun.forwardDynamic(localConn, sshClient)
+	} else {
+		tun.forward(localConn, sshClient)
+	}
 	tun.removeConn()
 
 	return nil
 }
 
-func (tun *SshTunnel) addConn() error {
-	tun.mutex.Lock()
-	defer tun.mutex.Unlock()
+// addConn returns the SSH client the connection should be forwarded through, dialing the server if there
+// is no live client. Dial failures caused by the network are retried with backoff. The server is dialed without
+// holding the client mutex, so other connections can still be added and removed in the meantime.
+func (tun *SshTunnel) addConn() (*ssh.Client, error) {
+	tun.clientMutex.Lock()
+	if tun.SshClient != nil {
+		tun.active += 1
+		sshClient := tun.SshClient
+		tun.clientMutex.Unlock()
+		return sshClient, nil
+	}
+	tun.clientMutex.Unlock()
 
-	if tun.active == 0 {
-		sshClient, err := ssh.Dial(tun.Server.Type(), tun.Server.String(), tun.SshConfig)
-		if err != nil {
-			return fmt.Errorf("ssh dial %s to %s failed: %w", tun.Server.Type(), tun.Server.String(), err)
-		}
+	sshClient, err := tun.dialWithBackoff()
+	if err != nil {
+		return nil, err
+	}
+
+	tun.clientMutex.Lock()
+	defer tun.clientMutex.Unlock()
+
+	// Another connection or a reconnect may have installed a client while this one was dialing
+	if tun.SshClient != nil {
+		tun.release(sshClient)
+	} else {
 		tun.SshClient = sshClient
+		tun.startKeepAlive(sshClient)
 	}
 
 	tun.active += 1
 
-	return nil
+	return tun.SshClient, nil
 }
 
 func (tun *SshTunnel) removeConn() {
-	tun.mutex.Lock()
-	defer tun.mutex.Unlock()
+	tun.clientMutex.Lock()
+	defer tun.clientMutex.Unlock()
 
 	tun.active -= 1
 
-	if tun.active == 0 {
-		tun.SshClient.Close()
+	if tun.active == 0 && tun.SshClient != nil {
+		tun.stopKeepAlive()
+		tun.release(tun.SshClient)
 		tun.SshClient = nil
 	}
 }
@@ -12,39 +12,39 @@ import (
 
 func ForwardRemoteUnixSock(ctx context.Context, targetOptions types.TargetConfigOptions, localSock string, remoteSock string) (chan bool, chan error) {
 	if targetOptions.RemoteHostname == nil {
-		errChan := make(chan error)
-		errChan <- errors.New("Remote Hostname is required")
-		return make(chan bool), errChan
+		return failedTunnel(errors.New("Remote Hostname is required"))
 	}
 
-	sshTun := ssh_tunnel.NewUnix(localSock, *targetOptions.RemoteHostname, remoteSock)
-
-	if targetOptions.RemotePort != nil {
-		sshTun.SetPort(*targetOptions.RemotePort)
+	sshTun, err := newSshTunnel(targetOptions)
+	if err != nil {
+		return failedTunnel(err)
 	}
-	if targetOptions.RemoteUser != nil {
-		sshTun.SetUser(*targetOptions.RemoteUser)
+	sshTun.SetLocalEndpoint(ssh_tunnel.NewUnixEndpoint(localSock))
+	sshTun.SetRemoteEndpoint(ssh_tunnel.NewUnixEndpoint(remoteSock))
+
+	return startTunnel(ctx, sshTun)
+}
+
+// ForwardLocalToRemote listens on the remote endpoint on the remote host of the target and forwards the connections
+// to the local endpoint (like `ssh -R`)
+func ForwardLocalToRemote(ctx context.Context, targetOptions types.TargetConfigOptions, remote *ssh_tunnel.Endpoint, local *ssh_tunnel.Endpoint) (chan bool, chan error) {
+	if targetOptions.RemoteHostname == nil {
+		return failedTunnel(errors.New("Remote Hostname is required"))
 	}
 
-	if targetOptions.RemotePassword != nil && *targetOptions.RemotePassword != "" {
-		sshTun.SetPassword(*targetOptions.RemotePassword)
-	} else if targetOptions.RemotePrivateKey != nil && *targetOptions.RemotePrivateKey != "" {
-		privateKeyPath, password, err := GetSshPrivateKeyPath(*targetOptions.RemotePrivateKey)
-		if err != nil {
-			log.Fatal(err)
-		}
-		if password != nil {
-			sshTun.SetEncryptedKeyFile(privateKeyPath, *password)
-		} else {
-			sshTun.SetKeyFile(privateKeyPath)
-		}
+	sshTun, err := newSshTunnel(targetOptions)
+	if err != nil {
+		return failedTunnel(err)
 	}
+	sshTun.SetReverse(true)
+	sshTun.SetRemoteEndpoint(remote)
+	sshTun.SetLocalEndpoint(local)
 
-	errChan := make(chan error)
+	return startTunnel(ctx, sshTun)
+}
 
-	sshTun.SetTunneledConnState(func(tun *ssh_tunnel.SshTunnel, state *ssh_tunnel.TunneledConnectionState) {
-		log.Debugf("%+v", state)
-	})
+func startTunnel(ctx context.Context, sshTun *ssh_tunnel.SshTunnel) (chan bool, chan error) {
+	errChan := make(chan error)
 
 	startedChann := make(chan bool, 1)
 
@@ -54,7 +54,13 @@ func ForwardRemoteUnixSock(ctx context.Context, targetOptions types.TargetConfig
 			log.Debugf("SSH Tunnel is Starting")
 		case ssh_tunnel.StateStarted:
 			log.Debugf("SSH Tunnel is Started")
-			startedChann <- true
+			// StateStarted is reported again after every reconnect, nobody waits for those
+			select {
+			case startedChann <- true:
+			default:
+			}
+		case ssh_tunnel.StateReconnecting:
+			log.Debugf("SSH Tunnel is Reconnecting")
 		case ssh_tunnel.StateStopped:
 			log.Debugf("SSH Tunnel is Stopped")
 		}
@@ -66,3 +72,9 @@ func ForwardRemoteUnixSock(ctx context.Context, targetOptions types.TargetConfig
 
 	return startedChann, errChan
 }
+
+func failedTunnel(err error) (chan bool, chan error) {
+	errChan := make(chan error, 1)
+	errChan <- err
+	return make(chan bool, 1), errChan
+}
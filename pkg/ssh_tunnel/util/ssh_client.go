@@ -0,0 +1,394 @@
+package util
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/daytonaio/daytona-provider-docker/pkg/ssh_tunnel"
+	"github.com/daytonaio/daytona-provider-docker/pkg/types"
+	"golang.org/x/crypto/ssh"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// GetRemoteClient returns a SSH connection to the remote host of the target from the shared pool, using the same
+// settings as the docker socket tunnel. The returned function must be called instead of closing the client.
+// The secrets of the target are only resolved when the pool doesn't hold a connection for its options yet.
+func GetRemoteClient(targetOptions types.TargetConfigOptions) (*ssh.Client, func(), error) {
+	if targetOptions.RemoteHostname == nil {
+		return nil, nil, errors.New("Remote Hostname is required")
+	}
+
+	sshClient, err := ssh_tunnel.DefaultPool.GetKeyed(ConnectionKey(targetOptions), func() (*ssh_tunnel.SshTunnel, error) {
+		return newSshTunnel(targetOptions)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return sshClient, func() {
+		ssh_tunnel.DefaultPool.Release(sshClient)
+	}, nil
+}
+
+// ResolveSshConfig returns the target options with the ssh config of the Remote Hostname applied, like the SSH
+// connections of the target are made
+func ResolveSshConfig(targetOptions types.TargetConfigOptions) types.TargetConfigOptions {
+	targetOptions, _ = applySshConfig(targetOptions)
+	return targetOptions
+}
+
+// ConnectionKey identifies the SSH connection of the target by its options, with the secret references unresolved
+// and the ssh config applied. It covers the host, the jump hosts, the auth method, the credentials and the host key
+// settings. The options that don't change the SSH connection are left out.
+func ConnectionKey(targetOptions types.TargetConfigOptions) string {
+	targetOptions, hostConfig := applySshConfig(targetOptions)
+	targetOptions.SchemaVersion = nil
+	targetOptions.ExposeServerApi = nil
+	targetOptions.SockPath = nil
+	targetOptions.RemoteConnectionMode = nil
+	targetOptions.DockerHost = nil
+	targetOptions.TlsCaCert = nil
+	targetOptions.TlsCert = nil
+	targetOptions.TlsKey = nil
+	targetOptions.DockerContext = nil
+	targetOptions.TargetDataDir = nil
+
+	// The options only hold strings, numbers and booleans, marshalling them can't fail
+	options, _ := json.Marshal(targetOptions)
+
+	// The agent socket and the known hosts files default to the environment of the provider
+	homeDir, _ := os.UserHomeDir()
+	return fmt.Sprintf("options=%x|identitiesOnly=%t|agent=%s|home=%s|known=%s",
+		sha256.Sum256(options),
+		hostConfig.identitiesOnly,
+		os.Getenv("SSH_AUTH_SOCK"),
+		homeDir,
+		managedKnownHostsFile(),
+	)
+}
+
+// newSshTunnel creates a SSH tunnel without endpoints configured from the target options. Options that are not
+// set explicitly are taken from the ssh config of the Remote Hostname.
+func newSshTunnel(targetOptions types.TargetConfigOptions) (*ssh_tunnel.SshTunnel, error) {
+	targetOptions, hostConfig := applySshConfig(targetOptions)
+
+	sshTun := ssh_tunnel.NewDialer(*targetOptions.RemoteHostname)
+	sshTun.SetTunneledConnState(logTunneledConnState)
+	sshTun.SetIdentitiesOnly(hostConfig.identitiesOnly)
+	sshTun.SetPool(ssh_tunnel.DefaultPool)
+
+	if targetOptions.RemotePort != nil {
+		sshTun.SetPort(*targetOptions.RemotePort)
+	}
+	if targetOptions.RemoteUser != nil {
+		sshTun.SetUser(*targetOptions.RemoteUser)
+	}
+
+	hostKeyPolicy := ssh_tunnel.HostKeyPolicyTrustOnFirstUse
+	if targetOptions.HostKeyPolicy != nil && *targetOptions.HostKeyPolicy != "" {
+		hostKeyPolicy = ssh_tunnel.HostKeyPolicy(*targetOptions.HostKeyPolicy)
+	}
+	sshTun.SetHostKeyPolicy(hostKeyPolicy)
+	sshTun.SetManagedKnownHostsFile(managedKnownHostsFile())
+
+	agentSocket := ""
+	if targetOptions.AgentSocket != nil {
+		agentSocket = *targetOptions.AgentSocket
+	}
+	sshTun.SetAgentSocket(agentSocket)
+	if targetOptions.AgentIdentities != nil && *targetOptions.AgentIdentities != "" {
+		sshTun.SetAgentIdentities(strings.Split(*targetOptions.AgentIdentities, ",")...)
+	}
+
+	passphrase, err := getPrivateKeyPassphrase(targetOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	// Secret references are resolved only now, the options hold where the secrets are read from
+	password, err := types.ResolveSecret(targetOptions.RemotePassword)
+	if err != nil {
+		return nil, fmt.Errorf("Remote Password: %w", err)
+	}
+	totpSecret, err := types.ResolveSecret(targetOptions.TotpSecret)
+	if err != nil {
+		return nil, fmt.Errorf("TOTP Secret: %w", err)
+	}
+	kbdAnswers, err := types.ResolveSecret(targetOptions.KbdAnswers)
+	if err != nil {
+		return nil, fmt.Errorf("Keyboard Interactive Answers: %w", err)
+	}
+	privateKeyData, err := types.ResolveSecret(targetOptions.RemotePrivateKeyData)
+	if err != nil {
+		return nil, fmt.Errorf("Remote Private Key: %w", err)
+	}
+
+	responder, err := keyboardInteractiveResponder(totpSecret, targetOptions.KbdCommand, kbdAnswers)
+	if err != nil {
+		return nil, fmt.Errorf("Keyboard Interactive Command: %w", err)
+	}
+
+	authMethod := ""
+	if targetOptions.AuthMethod != nil {
+		authMethod = *targetOptions.AuthMethod
+	}
+
+	err = configureAuth(sshTun, sshAuth{
+		method:         authMethod,
+		password:       password,
+		privateKey:     targetOptions.RemotePrivateKey,
+		privateKeyData: privateKeyData,
+		passphrase:     passphrase,
+		certificate:    targetOptions.RemoteCertificate,
+		responder:      responder,
+		responderID:    responderID(totpSecret, targetOptions.KbdCommand, kbdAnswers),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if targetOptions.JumpHosts != nil {
+		var jumpHosts []*ssh_tunnel.SshTunnel
+		for _, jumpHost := range *targetOptions.JumpHosts {
+			jumpTun := ssh_tunnel.NewDialer(jumpHost.Host)
+			jumpTun.SetTunneledConnState(logTunneledConnState)
+			if jumpHost.Port != 0 {
+				jumpTun.SetPort(jumpHost.Port)
+			}
+			if jumpHost.User != "" {
+				jumpTun.SetUser(jumpHost.User)
+			}
+			jumpTun.SetHostKeyPolicy(hostKeyPolicy)
+			jumpTun.SetManagedKnownHostsFile(managedKnownHostsFile())
+			// Jump hosts use the same ssh-agent, but not the identities of the target
+			jumpTun.SetAgentSocket(agentSocket)
+			jumpPassword, err := types.ResolveSecret(jumpHost.Password)
+			if err != nil {
+				return nil, fmt.Errorf("jump host %s: %w", jumpHost.Host, err)
+			}
+			jumpTotpSecret, err := types.ResolveSecret(jumpHost.TotpSecret)
+			if err != nil {
+				return nil, fmt.Errorf("jump host %s: %w", jumpHost.Host, err)
+			}
+
+			jumpResponder, err := keyboardInteractiveResponder(jumpTotpSecret, jumpHost.KbdCommand, nil)
+			if err != nil {
+				return nil, fmt.Errorf("jump host %s: kbd-command: %w", jumpHost.Host, err)
+			}
+
+			// Jump hosts share the passphrase of the target
+			err = configureAuth(jumpTun, sshAuth{
+				password:    jumpPassword,
+				privateKey:  jumpHost.PrivateKey,
+				passphrase:  passphrase,
+				responder:   jumpResponder,
+				responderID: responderID(jumpTotpSecret, jumpHost.KbdCommand, nil),
+			})
+			if err != nil {
+				return nil, fmt.Errorf("jump host %s: %w", jumpHost.Host, err)
+			}
+
+			jumpHosts = append(jumpHosts, jumpTun)
+		}
+		sshTun.SetJumpHosts(jumpHosts...)
+	}
+
+	return sshTun, nil
+}
+
+// sshAuth holds the authentication settings of a host
+type sshAuth struct {
+	// method is one of the types.AuthMethod values, empty for auto
+	method     string
+	password   *string
+	privateKey *string
+	// privateKeyData is the PEM content of the private key, it takes precedence over the privateKey path
+	privateKeyData *string
+	passphrase     *string
+	certificate    *string
+	responder      ssh_tunnel.KeyboardInteractiveResponder
+	// responderID identifies the settings of the responder in the pool key
+	responderID string
+}
+
+// configureAuth sets the authentication of the tunnel. With an explicit method only that method is offered to
+// the server, with auto it's picked from the settings that are set. The responder answers keyboard-interactive
+// prompts after the other methods.
+func configureAuth(sshTun *ssh_tunnel.SshTunnel, auth sshAuth) error {
+	var err error
+	switch auth.method {
+	case types.AuthMethodPassword:
+		if auth.password == nil || *auth.password == "" {
+			return fmt.Errorf("the %s auth method requires the Remote Password", auth.method)
+		}
+		sshTun.SetPassword(*auth.password)
+	case types.AuthMethodKeyFile:
+		if auth.privateKey == nil || *auth.privateKey == "" {
+			return fmt.Errorf("the %s auth method requires the Remote Private Key Path", auth.method)
+		}
+		err = setKeyFile(sshTun, *auth.privateKey, auth.passphrase, "")
+	case types.AuthMethodInlineKey:
+		if auth.privateKeyData == nil || *auth.privateKeyData == "" {
+			return fmt.Errorf("the %s auth method requires the Remote Private Key", auth.method)
+		}
+		err = setKeyData(sshTun, *auth.privateKeyData, auth.passphrase)
+	case types.AuthMethodAgent:
+		sshTun.SetSSHServer()
+	case types.AuthMethodCertificate:
+		certificatePath := ""
+		if auth.certificate != nil && *auth.certificate != "" {
+			certificatePath = *auth.certificate
+		} else if auth.privateKey != nil && *auth.privateKey != "" {
+			certificatePath = *auth.privateKey + "-cert.pub"
+		} else {
+			return fmt.Errorf("the %s auth method requires the Remote Certificate Path", auth.method)
+		}
+
+		if auth.privateKey != nil && *auth.privateKey != "" {
+			err = setKeyFile(sshTun, *auth.privateKey, auth.passphrase, certificatePath)
+		} else {
+			// The key of the certificate is held by the ssh-agent
+			sshTun.SetCertificate("", certificatePath)
+		}
+	case "", types.AuthMethodAuto:
+		err = configureAutoAuth(sshTun, auth)
+	default:
+		return fmt.Errorf("unknown auth method %s", auth.method)
+	}
+	if err != nil {
+		return err
+	}
+
+	if auth.method != "" && auth.method != types.AuthMethodAuto {
+		sshTun.SetExclusiveAuth(true)
+	}
+
+	if auth.responder != nil {
+		sshTun.SetKeyboardInteractiveResponder(auth.responder)
+		sshTun.SetKeyboardInteractiveID(auth.responderID)
+	}
+
+	return nil
+}
+
+// configureAutoAuth guesses the authentication from the settings: the password, then the private key content, then
+// the private key, then the certificate, then keyboard-interactive. A certificate is used with the private key if one is set or if a
+// `-cert.pub` file exists next to the key, like ssh does.
+func configureAutoAuth(sshTun *ssh_tunnel.SshTunnel, auth sshAuth) error {
+	certificatePath := ""
+	if auth.certificate != nil {
+		certificatePath = *auth.certificate
+	}
+
+	if auth.password != nil && *auth.password != "" {
+		sshTun.SetPassword(*auth.password)
+	} else if auth.privateKeyData != nil && *auth.privateKeyData != "" {
+		return setKeyData(sshTun, *auth.privateKeyData, auth.passphrase)
+	} else if auth.privateKey != nil && *auth.privateKey != "" {
+		if certificatePath == "" {
+			if _, err := os.Stat(*auth.privateKey + "-cert.pub"); err == nil {
+				certificatePath = *auth.privateKey + "-cert.pub"
+			}
+		}
+
+		return setKeyFile(sshTun, *auth.privateKey, auth.passphrase, certificatePath)
+	} else if certificatePath != "" {
+		// The key of the certificate is held by the ssh-agent
+		sshTun.SetCertificate("", certificatePath)
+	} else if auth.responder != nil {
+		sshTun.SetKeyboardInteractive(auth.responder)
+	}
+
+	return nil
+}
+
+// setKeyFile sets the private key, encrypted or not, together with its certificate if certificatePath is set
+func setKeyFile(sshTun *ssh_tunnel.SshTunnel, privateKey string, passphrase *string, certificatePath string) error {
+	privateKeyPath, password, err := GetSshPrivateKeyPath(privateKey, passphrase)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case certificatePath != "" && password != nil:
+		sshTun.SetEncryptedCertificate(privateKeyPath, certificatePath, *password)
+	case certificatePath != "":
+		sshTun.SetCertificate(privateKeyPath, certificatePath)
+	case password != nil:
+		sshTun.SetEncryptedKeyFile(privateKeyPath, *password)
+	default:
+		sshTun.SetKeyFile(privateKeyPath)
+	}
+
+	return nil
+}
+
+// setKeyData sets the private key from its content, encrypted or not
+func setKeyData(sshTun *ssh_tunnel.SshTunnel, privateKeyData string, passphrase *string) error {
+	keyContent, password, err := getInlinePrivateKey(privateKeyData, passphrase)
+	if err != nil {
+		return err
+	}
+
+	// A bytes.Reader can be rewound, the key is read again every time the SSH config is initialized
+	if password != nil {
+		sshTun.SetEncryptedKeyReader(bytes.NewReader(keyContent), *password)
+	} else {
+		sshTun.SetKeyReader(bytes.NewReader(keyContent))
+	}
+
+	return nil
+}
+
+// keyboardInteractiveResponder returns the responder for the configured keyboard-interactive answers, or nil if
+// none are configured. A TOTP secret takes precedence over a command, which takes precedence over static answers.
+func keyboardInteractiveResponder(totpSecret *string, command *string, answers *string) (ssh_tunnel.KeyboardInteractiveResponder, error) {
+	// The command runs on the provider host, it's refused even if the TOTP secret takes precedence
+	if command != nil && *command != "" && !types.CommandsAllowed() {
+		return nil, types.ErrCommandsNotAllowed
+	}
+
+	switch {
+	case totpSecret != nil && *totpSecret != "":
+		return ssh_tunnel.TOTPResponder(*totpSecret), nil
+	case command != nil && *command != "":
+		return ssh_tunnel.CommandResponder(*command), nil
+	case answers != nil && *answers != "":
+		return ssh_tunnel.StaticResponder(strings.Split(*answers, ",")...), nil
+	}
+
+	return nil, nil
+}
+
+// responderID hashes the settings keyboardInteractiveResponder creates the responder from
+func responderID(totpSecret *string, command *string, answers *string) string {
+	hash := sha256.New()
+	for _, setting := range []*string{totpSecret, command, answers} {
+		if setting != nil {
+			hash.Write([]byte(*setting))
+		}
+		hash.Write([]byte{0})
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil))
+}
+
+func logTunneledConnState(tun *ssh_tunnel.SshTunnel, state *ssh_tunnel.TunneledConnectionState) {
+	log.Debugf("%+v", state)
+}
+
+// managedKnownHostsFile returns the known hosts file where the provider records trusted host keys
+func managedKnownHostsFile() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(configDir, "daytona", "docker-provider", "known_hosts")
+}
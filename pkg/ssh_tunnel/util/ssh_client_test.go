@@ -0,0 +1,56 @@
+package util
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/daytonaio/daytona-provider-docker/pkg/types"
+)
+
+func TestKeyboardInteractiveCommandNotAllowed(t *testing.T) {
+	command := "pass show docker/otp"
+	totpSecret := "JBSWY3DPEHPK3PXP"
+
+	t.Setenv(types.AllowCommandsEnv, "")
+	_, err := keyboardInteractiveResponder(nil, &command, nil)
+	if !errors.Is(err, types.ErrCommandsNotAllowed) {
+		t.Errorf("Expected the command to be refused, got %v", err)
+	}
+	// A TOTP secret taking precedence doesn't make the command allowed
+	_, err = keyboardInteractiveResponder(&totpSecret, &command, nil)
+	if !errors.Is(err, types.ErrCommandsNotAllowed) {
+		t.Errorf("Expected the command to be refused, got %v", err)
+	}
+
+	t.Setenv(types.AllowCommandsEnv, "true")
+	responder, err := keyboardInteractiveResponder(nil, &command, nil)
+	if err != nil || responder == nil {
+		t.Errorf("Expected a command responder, got %v", err)
+	}
+}
+
+func TestConnectionKey(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv(types.AllowCommandsEnv, "")
+
+	hostname := "docker.example.com"
+	password := "cmd:pass show docker/prod"
+	options := types.TargetConfigOptions{RemoteHostname: &hostname, RemotePassword: &password}
+
+	// The key is computed without resolving the secrets, the command isn't allowed to run
+	key := ConnectionKey(options)
+
+	exposeServerApi := true
+	withApi := options
+	withApi.ExposeServerApi = &exposeServerApi
+	if ConnectionKey(withApi) != key {
+		t.Errorf("Expected the options that don't change the connection to be left out of the key")
+	}
+
+	otherPassword := "cmd:pass show docker/staging"
+	withPassword := options
+	withPassword.RemotePassword = &otherPassword
+	if ConnectionKey(withPassword) == key {
+		t.Errorf("Expected another password reference to change the key")
+	}
+}
@@ -0,0 +1,234 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/daytonaio/daytona-provider-docker/pkg/types"
+	"github.com/kevinburke/ssh_config"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// sshHostConfig holds the settings of a host resolved from the user's and the system's ssh config
+type sshHostConfig struct {
+	hostname        string
+	port            int
+	user            string
+	identityFile    string
+	certificateFile string
+	identitiesOnly  bool
+	identityAgent   string
+	proxyJump       string
+}
+
+// lookupSshConfig resolves a host alias through `~/.ssh/config` and `/etc/ssh/ssh_config`.
+// Values from the user's config take precedence over the system config.
+func lookupSshConfig(alias string) *sshHostConfig {
+	configs := loadSshConfigs()
+
+	hostConfig := &sshHostConfig{
+		hostname: alias,
+	}
+
+	if hostname := getSshConfigValue(configs, alias, "HostName"); hostname != "" {
+		hostConfig.hostname = expandSshConfigTokens(hostname, alias, "", 0)
+	}
+
+	if port := getSshConfigValue(configs, alias, "Port"); port != "" {
+		p, err := strconv.Atoi(port)
+		if err != nil {
+			log.Warnf("ignoring invalid Port %q for %s in ssh config", port, alias)
+		} else {
+			hostConfig.port = p
+		}
+	}
+
+	hostConfig.user = getSshConfigValue(configs, alias, "User")
+	hostConfig.identitiesOnly = strings.EqualFold(getSshConfigValue(configs, alias, "IdentitiesOnly"), "yes")
+	hostConfig.proxyJump = getSshConfigValue(configs, alias, "ProxyJump")
+
+	// `none` disables the agent and `SSH_AUTH_SOCK` is the default, only sockets and environment variables are used
+	identityAgent := getSshConfigValue(configs, alias, "IdentityAgent")
+	switch {
+	case identityAgent == "", strings.EqualFold(identityAgent, "none"), identityAgent == "SSH_AUTH_SOCK":
+	case strings.HasPrefix(identityAgent, "$"):
+		hostConfig.identityAgent = os.Getenv(strings.Trim(identityAgent[1:], "{}"))
+	default:
+		hostConfig.identityAgent = expandSshConfigTokens(identityAgent, hostConfig.hostname, hostConfig.user, hostConfig.port)
+	}
+
+	for _, config := range configs {
+		identityFiles, err := getAllSshConfigValues(config, alias, "IdentityFile")
+		if err != nil {
+			continue
+		}
+		for _, identityFile := range identityFiles {
+			identityFile = expandSshConfigTokens(identityFile, hostConfig.hostname, hostConfig.user, hostConfig.port)
+			if _, err := os.Stat(identityFile); err == nil {
+				hostConfig.identityFile = identityFile
+				break
+			}
+		}
+		if hostConfig.identityFile != "" {
+			break
+		}
+	}
+
+	if certificateFile := getSshConfigValue(configs, alias, "CertificateFile"); certificateFile != "" {
+		hostConfig.certificateFile = expandSshConfigTokens(certificateFile, hostConfig.hostname, hostConfig.user, hostConfig.port)
+	}
+
+	return hostConfig
+}
+
+// formerDefaultPort and formerDefaultPrivateKey were the manifest defaults of the Remote Port and the Remote Private
+// Key Path. The CLI prefilled them, so targets holding them are treated as if the options weren't set.
+const (
+	formerDefaultPort       = 22
+	formerDefaultPrivateKey = "~/.ssh"
+)
+
+// applySshConfig fills the target options that weren't set explicitly with the values from the ssh config
+// of the Remote Hostname. The Remote Hostname itself is replaced with the resolved HostName.
+func applySshConfig(targetOptions types.TargetConfigOptions) (types.TargetConfigOptions, *sshHostConfig) {
+	hostConfig := lookupSshConfig(*targetOptions.RemoteHostname)
+
+	targetOptions.RemoteHostname = &hostConfig.hostname
+
+	if targetOptions.RemotePort != nil && *targetOptions.RemotePort == formerDefaultPort {
+		targetOptions.RemotePort = nil
+	}
+	if targetOptions.RemotePrivateKey != nil && *targetOptions.RemotePrivateKey == formerDefaultPrivateKey {
+		targetOptions.RemotePrivateKey = nil
+	}
+
+	if targetOptions.RemotePort == nil && hostConfig.port != 0 {
+		targetOptions.RemotePort = &hostConfig.port
+	}
+	if (targetOptions.RemoteUser == nil || *targetOptions.RemoteUser == "") && hostConfig.user != "" {
+		targetOptions.RemoteUser = &hostConfig.user
+	}
+
+	passwordSet := targetOptions.RemotePassword != nil && *targetOptions.RemotePassword != ""
+	privateKeySet := targetOptions.RemotePrivateKey != nil && *targetOptions.RemotePrivateKey != ""
+	if !passwordSet && !privateKeySet && hostConfig.identityFile != "" {
+		targetOptions.RemotePrivateKey = &hostConfig.identityFile
+	}
+
+	certificateSet := targetOptions.RemoteCertificate != nil && *targetOptions.RemoteCertificate != ""
+	if !passwordSet && !certificateSet && hostConfig.certificateFile != "" {
+		targetOptions.RemoteCertificate = &hostConfig.certificateFile
+	}
+
+	if (targetOptions.AgentSocket == nil || *targetOptions.AgentSocket == "") && hostConfig.identityAgent != "" {
+		targetOptions.AgentSocket = &hostConfig.identityAgent
+	}
+
+	if targetOptions.JumpHosts == nil && hostConfig.proxyJump != "" && !strings.EqualFold(hostConfig.proxyJump, "none") {
+		jumpHosts, err := types.ParseJumpHosts(hostConfig.proxyJump)
+		if err != nil {
+			log.Warnf("ignoring invalid ProxyJump for %s in ssh config: %v", *targetOptions.RemoteHostname, err)
+		} else {
+			for i, jumpHost := range jumpHosts {
+				jumpHosts[i] = applySshConfigToJumpHost(jumpHost)
+			}
+			targetOptions.JumpHosts = &jumpHosts
+		}
+	}
+
+	return targetOptions, hostConfig
+}
+
+func applySshConfigToJumpHost(jumpHost types.JumpHost) types.JumpHost {
+	hostConfig := lookupSshConfig(jumpHost.Host)
+
+	jumpHost.Host = hostConfig.hostname
+	if jumpHost.Port == 0 {
+		jumpHost.Port = hostConfig.port
+	}
+	if jumpHost.User == "" {
+		jumpHost.User = hostConfig.user
+	}
+	if jumpHost.Password == nil && jumpHost.PrivateKey == nil && hostConfig.identityFile != "" {
+		jumpHost.PrivateKey = &hostConfig.identityFile
+	}
+
+	return jumpHost
+}
+
+func loadSshConfigs() []*ssh_config.Config {
+	var paths []string
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, filepath.Join(homeDir, ".ssh", "config"))
+	}
+	paths = append(paths, "/etc/ssh/ssh_config")
+
+	var configs []*ssh_config.Config
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+
+		config, err := ssh_config.Decode(f)
+		f.Close()
+		if err != nil {
+			log.Warnf("ignoring ssh config %s: %v", path, err)
+			continue
+		}
+		configs = append(configs, config)
+	}
+
+	return configs
+}
+
+func getSshConfigValue(configs []*ssh_config.Config, alias, key string) string {
+	for _, config := range configs {
+		values, err := getAllSshConfigValues(config, alias, key)
+		if err == nil && len(values) > 0 {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+// getAllSshConfigValues wraps Config.GetAll, which panics on Match directives
+func getAllSshConfigValues(config *ssh_config.Config, alias, key string) (values []string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("reading ssh config: %v", r)
+		}
+	}()
+
+	return config.GetAll(alias, key)
+}
+
+// expandSshConfigTokens expands `~` and the %d, %h, %p, %r, %u and %% tokens supported by ssh_config(5)
+func expandSshConfigTokens(value, hostname, remoteUser string, port int) string {
+	homeDir, _ := os.UserHomeDir()
+	localUser := ""
+	if usr, err := user.Current(); err == nil {
+		localUser = usr.Username
+	}
+	if port == 0 {
+		port = 22
+	}
+
+	if strings.HasPrefix(value, "~/") {
+		value = filepath.Join(homeDir, value[2:])
+	}
+
+	return strings.NewReplacer(
+		"%%", "%",
+		"%d", homeDir,
+		"%h", hostname,
+		"%p", strconv.Itoa(port),
+		"%r", remoteUser,
+		"%u", localUser,
+	).Replace(value)
+}
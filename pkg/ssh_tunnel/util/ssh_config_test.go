@@ -0,0 +1,152 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/daytonaio/daytona-provider-docker/pkg/types"
+)
+
+// writeSshConfig sets up a home directory holding the ssh config and the key it points to
+func writeSshConfig(t *testing.T, config string) string {
+	homeDir := t.TempDir()
+	t.Setenv("HOME", homeDir)
+
+	sshDir := filepath.Join(homeDir, ".ssh")
+	err := os.Mkdir(sshDir, 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(sshDir, "config"), []byte(config), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyPath := filepath.Join(sshDir, "id_prod")
+	err = os.WriteFile(keyPath, []byte("key"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return keyPath
+}
+
+func TestApplySshConfig(t *testing.T) {
+	keyPath := writeSshConfig(t, `
+Host prod
+    HostName docker.example.com
+    Port 2222
+    User deploy
+    IdentityFile ~/.ssh/id_prod
+`)
+
+	hostname := "prod"
+	port := 2200
+	formerPort := formerDefaultPort
+	otherUser := "admin"
+	otherKey := "/keys/id_ed25519"
+	formerKey := formerDefaultPrivateKey
+	password := "env:PROD_PASSWORD"
+
+	tests := []struct {
+		name       string
+		options    types.TargetConfigOptions
+		port       int
+		user       string
+		privateKey string
+	}{
+		{
+			name:       "unset options",
+			options:    types.TargetConfigOptions{},
+			port:       2222,
+			user:       "deploy",
+			privateKey: keyPath,
+		},
+		{
+			name:       "explicit options",
+			options:    types.TargetConfigOptions{RemotePort: &port, RemoteUser: &otherUser, RemotePrivateKey: &otherKey},
+			port:       port,
+			user:       otherUser,
+			privateKey: otherKey,
+		},
+		{
+			name:       "former defaults",
+			options:    types.TargetConfigOptions{RemotePort: &formerPort, RemotePrivateKey: &formerKey},
+			port:       2222,
+			user:       "deploy",
+			privateKey: keyPath,
+		},
+		{
+			name:    "password",
+			options: types.TargetConfigOptions{RemotePassword: &password},
+			port:    2222,
+			user:    "deploy",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			options := test.options
+			options.RemoteHostname = &hostname
+
+			options, _ = applySshConfig(options)
+
+			if *options.RemoteHostname != "docker.example.com" {
+				t.Errorf("Expected the HostName of the ssh config, got %s", *options.RemoteHostname)
+			}
+			if options.RemotePort == nil || *options.RemotePort != test.port {
+				t.Errorf("Expected port %d, got %v", test.port, options.RemotePort)
+			}
+			if options.RemoteUser == nil || *options.RemoteUser != test.user {
+				t.Errorf("Expected user %s, got %v", test.user, options.RemoteUser)
+			}
+
+			privateKey := ""
+			if options.RemotePrivateKey != nil {
+				privateKey = *options.RemotePrivateKey
+			}
+			if privateKey != test.privateKey {
+				t.Errorf("Expected private key %q, got %q", test.privateKey, privateKey)
+			}
+		})
+	}
+}
+
+func TestApplySshConfigUnknownHost(t *testing.T) {
+	writeSshConfig(t, "Host prod\n    Port 2222\n")
+
+	hostname := "docker.example.com"
+	formerPort := formerDefaultPort
+	formerKey := formerDefaultPrivateKey
+
+	options, _ := applySshConfig(types.TargetConfigOptions{
+		RemoteHostname:   &hostname,
+		RemotePort:       &formerPort,
+		RemotePrivateKey: &formerKey,
+	})
+
+	if *options.RemoteHostname != hostname {
+		t.Errorf("Expected the hostname to be kept, got %s", *options.RemoteHostname)
+	}
+	// The SSH client falls back to port 22 and the default keys
+	if options.RemotePort != nil {
+		t.Errorf("Expected no port, got %d", *options.RemotePort)
+	}
+	if options.RemotePrivateKey != nil {
+		t.Errorf("Expected no private key, got %s", *options.RemotePrivateKey)
+	}
+}
+
+func TestGetSshPrivateKeyPathExpandsHome(t *testing.T) {
+	homeDir := t.TempDir()
+	t.Setenv("HOME", homeDir)
+
+	_, _, err := GetSshPrivateKeyPath("~/.ssh/id_missing", nil)
+	if !os.IsNotExist(err) {
+		t.Fatalf("Expected the key to be missing, got %v", err)
+	}
+	if pathErr, ok := err.(*os.PathError); !ok || pathErr.Path != filepath.Join(homeDir, ".ssh", "id_missing") {
+		t.Errorf("Expected the path to be expanded, got %v", err)
+	}
+}
@@ -1,15 +1,34 @@
 package util
 
 import (
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 
+	"github.com/daytonaio/daytona-provider-docker/pkg/types"
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/term"
 )
 
-// GetSshPrivateKeyPath returns the path to the private key and the password if it's encrypted
-func GetSshPrivateKeyPath(privateKeyPath string) (string, *string, error) {
+// PassphraseEnvVar is the environment variable the passphrase of encrypted private keys is read from if it's not
+// set in the target options
+const PassphraseEnvVar = "DAYTONA_SSH_KEY_PASSPHRASE"
+
+// GetSshPrivateKeyPath returns the path to the private key and the password if it's encrypted.
+// The passphrase is only prompted for if it's not provided and a terminal is attached, otherwise an error is returned.
+func GetSshPrivateKeyPath(privateKeyPath string, passphrase *string) (string, *string, error) {
+	// The path is taken as typed in the CLI, where ~ isn't expanded
+	if strings.HasPrefix(privateKeyPath, "~/") {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", nil, err
+		}
+		privateKeyPath = filepath.Join(homeDir, privateKeyPath[2:])
+	}
+
 	keyContent, err := os.ReadFile(privateKeyPath)
 	if err != nil {
 		return "", nil, err
@@ -20,18 +39,105 @@ func GetSshPrivateKeyPath(privateKeyPath string) (string, *string, error) {
 		return privateKeyPath, nil, err
 	}
 
-	if err.Error() == (&ssh.PassphraseMissingError{}).Error() {
-		fmt.Print("Enter password for key: ")
-		password, err := term.ReadPassword(0)
-		fmt.Println()
+	var passphraseMissingErr *ssh.PassphraseMissingError
+	if !errors.As(err, &passphraseMissingErr) {
+		return "", nil, err
+	}
+
+	if passphrase != nil {
+		_, err = ssh.ParsePrivateKeyWithPassphrase(keyContent, []byte(*passphrase))
 		if err != nil {
-			return "", nil, err
+			return "", nil, fmt.Errorf("failed to decrypt private key %s: %w", privateKeyPath, err)
+		}
+
+		return privateKeyPath, passphrase, nil
+	}
+
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", nil, fmt.Errorf("private key %s is encrypted, set the Remote Private Key Passphrase or the %s environment variable", privateKeyPath, PassphraseEnvVar)
+	}
+
+	fmt.Print("Enter password for key: ")
+	password, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Println()
+	if err != nil {
+		return "", nil, err
+	}
+
+	stringPassword := string(password)
+
+	return privateKeyPath, &stringPassword, nil
+}
+
+// getInlinePrivateKey returns the PEM content of the Remote Private Key and the password if it's encrypted.
+// Newlines written as `\n` are restored and base64 encoded content is decoded, so the key can be entered in a single
+// line. The passphrase is never prompted for, inline keys are meant for runners without a terminal.
+func getInlinePrivateKey(content string, passphrase *string) ([]byte, *string, error) {
+	keyContent := normalizeInlinePrivateKey(content)
+
+	_, err := ssh.ParsePrivateKey(keyContent)
+	if err == nil {
+		return keyContent, nil, nil
+	}
+
+	var passphraseMissingErr *ssh.PassphraseMissingError
+	if !errors.As(err, &passphraseMissingErr) {
+		return nil, nil, fmt.Errorf("failed to parse the Remote Private Key: %w", err)
+	}
+
+	if passphrase == nil {
+		return nil, nil, fmt.Errorf("the Remote Private Key is encrypted, set the Remote Private Key Passphrase or the %s environment variable", PassphraseEnvVar)
+	}
+
+	_, err = ssh.ParsePrivateKeyWithPassphrase(keyContent, []byte(*passphrase))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decrypt the Remote Private Key: %w", err)
+	}
+
+	return keyContent, passphrase, nil
+}
+
+func normalizeInlinePrivateKey(content string) []byte {
+	content = strings.TrimSpace(content)
+
+	if !strings.HasPrefix(content, "-----BEGIN") {
+		decoded, err := base64.StdEncoding.DecodeString(content)
+		if err == nil {
+			content = strings.TrimSpace(string(decoded))
 		}
+	}
 
-		stringPassword := string(password)
+	if !strings.Contains(content, "\n") {
+		content = strings.ReplaceAll(content, `\n`, "\n")
+	}
+
+	return []byte(content + "\n")
+}
+
+// getPrivateKeyPassphrase returns the passphrase from the target options, the passphrase file or the environment,
+// in that order. Nil is returned if none is set.
+func getPrivateKeyPassphrase(targetOptions types.TargetConfigOptions) (*string, error) {
+	if targetOptions.RemotePassphrase != nil && *targetOptions.RemotePassphrase != "" {
+		passphrase, err := types.ResolveSecret(targetOptions.RemotePassphrase)
+		if err != nil {
+			return nil, fmt.Errorf("Remote Private Key Passphrase: %w", err)
+		}
+		return passphrase, nil
+	}
+
+	if targetOptions.RemotePassphraseFile != nil && *targetOptions.RemotePassphraseFile != "" {
+		content, err := os.ReadFile(*targetOptions.RemotePassphraseFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read passphrase file: %w", err)
+		}
+
+		passphrase := strings.TrimRight(string(content), "\r\n")
+		return &passphrase, nil
+	}
 
-		return privateKeyPath, &stringPassword, nil
+	if passphrase, ok := os.LookupEnv(PassphraseEnvVar); ok {
+		return &passphrase, nil
 	}
 
-	return "", nil, err
+	return nil, nil
 }
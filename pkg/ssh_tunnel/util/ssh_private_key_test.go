@@ -0,0 +1,80 @@
+package util
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestGetInlinePrivateKey(t *testing.T) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, err := ssh.MarshalPrivateKey(privateKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPem := string(pem.EncodeToMemory(block))
+
+	encryptedBlock, err := ssh.MarshalPrivateKeyWithPassphrase(privateKey, "", []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryptedPem := string(pem.EncodeToMemory(encryptedBlock))
+
+	passphrase := "secret"
+	wrongPassphrase := "wrong"
+
+	tests := []struct {
+		name       string
+		content    string
+		passphrase *string
+		encrypted  bool
+		err        string
+	}{
+		{name: "pem", content: keyPem},
+		{name: "escaped newlines", content: strings.ReplaceAll(strings.TrimSpace(keyPem), "\n", `\n`)},
+		{name: "base64", content: base64.StdEncoding.EncodeToString([]byte(keyPem))},
+		{name: "encrypted", content: encryptedPem, passphrase: &passphrase, encrypted: true},
+		{name: "encrypted without passphrase", content: encryptedPem, err: "is encrypted"},
+		{name: "encrypted with wrong passphrase", content: encryptedPem, passphrase: &wrongPassphrase, err: "failed to decrypt"},
+		{name: "invalid", content: "not a key", err: "failed to parse"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			keyContent, password, err := getInlinePrivateKey(test.content, test.passphrase)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("Expected error containing %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %s", err)
+			}
+
+			if test.encrypted {
+				if password == nil || *password != passphrase {
+					t.Fatalf("Expected the passphrase to be returned for an encrypted key")
+				}
+				_, err = ssh.ParsePrivateKeyWithPassphrase(keyContent, []byte(*password))
+			} else {
+				if password != nil {
+					t.Fatalf("Expected no passphrase for an unencrypted key")
+				}
+				_, err = ssh.ParsePrivateKey(keyContent)
+			}
+			if err != nil {
+				t.Errorf("Expected a parsable key, got %s", err)
+			}
+		})
+	}
+}
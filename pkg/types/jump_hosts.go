@@ -0,0 +1,180 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// JumpHost is a bastion host the SSH connection to the remote host is made through.
+type JumpHost struct {
+	Host       string  `json:"Host"`
+	Port       int     `json:"Port,omitempty"`
+	User       string  `json:"User,omitempty"`
+	Password   *string `json:"Password,omitempty"`
+	PrivateKey *string `json:"Private Key Path,omitempty"`
+	TotpSecret *string `json:"TOTP Secret,omitempty"`
+	KbdCommand *string `json:"Keyboard Interactive Command,omitempty"`
+}
+
+// JumpHosts is an ordered chain of jump hosts.
+// It is stored as a comma separated string of `user@host:port` entries. Each entry can specify its own
+// authentication with the `key`, `password`, `totp` and `kbd-command` query parameters,
+// e.g. `user@bastion:22?key=~/.ssh/bastion&totp=env:BASTION_TOTP`. The option isn't masked and is stored as is, so
+// the password and TOTP secret must be secret references.
+type JumpHosts []JumpHost
+
+func (j JumpHosts) String() string {
+	entries := make([]string, 0, len(j))
+	for _, jumpHost := range j {
+		entries = append(entries, jumpHost.String())
+	}
+	return strings.Join(entries, ",")
+}
+
+func (j JumpHosts) MarshalJSON() ([]byte, error) {
+	return json.Marshal(j.String())
+}
+
+func (j *JumpHosts) UnmarshalJSON(data []byte) error {
+	var value string
+	err := json.Unmarshal(data, &value)
+	if err != nil {
+		// Also accept the expanded form, a list of jump host objects
+		var jumpHosts []JumpHost
+		if err := json.Unmarshal(data, &jumpHosts); err != nil {
+			return fmt.Errorf("Jump Hosts must be a comma separated list of user@host:port entries")
+		}
+		for _, jumpHost := range jumpHosts {
+			if err := jumpHost.checkSecretReferences(); err != nil {
+				return err
+			}
+		}
+		*j = jumpHosts
+		return nil
+	}
+
+	jumpHosts, err := ParseJumpHosts(value)
+	if err != nil {
+		return err
+	}
+
+	*j = jumpHosts
+	return nil
+}
+
+// ParseJumpHosts parses a comma separated list of `user@host:port` entries
+func ParseJumpHosts(value string) (JumpHosts, error) {
+	var jumpHosts JumpHosts
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		jumpHost, err := ParseJumpHost(entry)
+		if err != nil {
+			return nil, err
+		}
+		jumpHosts = append(jumpHosts, *jumpHost)
+	}
+
+	return jumpHosts, nil
+}
+
+// ParseJumpHost parses a single `user@host:port?key=path&password=ref&totp=ref&kbd-command=command` entry. The
+// password and TOTP secret must be secret references.
+func ParseJumpHost(entry string) (*JumpHost, error) {
+	u, err := url.Parse("ssh://" + entry)
+	if err != nil {
+		return nil, fmt.Errorf("invalid jump host %q: %w", entry, err)
+	}
+
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid jump host %q: missing host", entry)
+	}
+
+	jumpHost := &JumpHost{
+		Host: u.Hostname(),
+		User: u.User.Username(),
+	}
+
+	if u.Port() != "" {
+		jumpHost.Port, err = strconv.Atoi(u.Port())
+		if err != nil {
+			return nil, fmt.Errorf("invalid jump host %q: invalid port", entry)
+		}
+	}
+
+	query := u.Query()
+	if query.Has("key") {
+		key := query.Get("key")
+		jumpHost.PrivateKey = &key
+	}
+	if query.Has("password") {
+		password := query.Get("password")
+		jumpHost.Password = &password
+	}
+	if query.Has("totp") {
+		totpSecret := query.Get("totp")
+		jumpHost.TotpSecret = &totpSecret
+	}
+	if query.Has("kbd-command") {
+		kbdCommand := query.Get("kbd-command")
+		jumpHost.KbdCommand = &kbdCommand
+	}
+
+	err = jumpHost.checkSecretReferences()
+	if err != nil {
+		return nil, err
+	}
+
+	return jumpHost, nil
+}
+
+// checkSecretReferences rejects raw secrets, they would be stored and shown in plain text. The error doesn't
+// include the secret.
+func (j JumpHost) checkSecretReferences() error {
+	for _, secret := range []struct {
+		name  string
+		value *string
+	}{
+		{name: "password", value: j.Password},
+		{name: "totp", value: j.TotpSecret},
+	} {
+		if secret.value != nil && *secret.value != "" && !IsSecretReference(*secret.value) {
+			return fmt.Errorf("invalid jump host %s: the %s must be an env:NAME, file:/path or cmd:command reference, raw secrets are stored in plain text", j.Host, secret.name)
+		}
+	}
+	return nil
+}
+
+func (j JumpHost) String() string {
+	u := url.URL{Host: j.Host}
+	if j.Port != 0 {
+		u.Host = net.JoinHostPort(j.Host, strconv.Itoa(j.Port))
+	}
+	if j.User != "" {
+		u.User = url.User(j.User)
+	}
+
+	query := url.Values{}
+	if j.PrivateKey != nil {
+		query.Set("key", *j.PrivateKey)
+	}
+	if j.Password != nil {
+		query.Set("password", *j.Password)
+	}
+	if j.TotpSecret != nil {
+		query.Set("totp", *j.TotpSecret)
+	}
+	if j.KbdCommand != nil {
+		query.Set("kbd-command", *j.KbdCommand)
+	}
+	u.RawQuery = query.Encode()
+
+	return strings.TrimPrefix(u.String(), "//")
+}
@@ -0,0 +1,86 @@
+package types
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestParseJumpHosts(t *testing.T) {
+	jumpHosts, err := ParseJumpHosts("admin@bastion:2222?key=/keys/bastion, build@10.0.0.2")
+	if err != nil {
+		t.Fatalf("Error parsing jump hosts: %s", err)
+	}
+
+	if len(jumpHosts) != 2 {
+		t.Fatalf("Expected 2 jump hosts, got %d", len(jumpHosts))
+	}
+
+	first := jumpHosts[0]
+	if first.Host != "bastion" || first.Port != 2222 || first.User != "admin" {
+		t.Errorf("Unexpected first jump host: %+v", first)
+	}
+	if first.PrivateKey == nil || *first.PrivateKey != "/keys/bastion" {
+		t.Errorf("Expected private key /keys/bastion, got %v", first.PrivateKey)
+	}
+
+	second := jumpHosts[1]
+	if second.Host != "10.0.0.2" || second.Port != 0 || second.User != "build" || second.PrivateKey != nil {
+		t.Errorf("Unexpected second jump host: %+v", second)
+	}
+}
+
+func TestJumpHostsJsonRoundTrip(t *testing.T) {
+	var opts TargetConfigOptions
+	err := json.Unmarshal([]byte(`{"Jump Hosts": "admin@bastion:2222?key=/keys/bastion"}`), &opts)
+	if err != nil {
+		t.Fatalf("Error unmarshalling options: %s", err)
+	}
+
+	out, err := json.Marshal(opts)
+	if err != nil {
+		t.Fatalf("Error marshalling options: %s", err)
+	}
+
+	expected := `{"Jump Hosts":"admin@bastion:2222?key=%2Fkeys%2Fbastion"}`
+	if string(out) != expected {
+		t.Errorf("Expected %s, got %s", expected, out)
+	}
+}
+
+func TestJumpHostSecrets(t *testing.T) {
+	_, err := ParseJumpHosts("admin@bastion?password=hunter2")
+	if err == nil {
+		t.Fatalf("Expected a raw password to be rejected")
+	}
+	if strings.Contains(err.Error(), "hunter2") {
+		t.Errorf("Expected the error not to contain the password, got %s", err)
+	}
+
+	_, err = ParseJumpHosts("admin@bastion?totp=JBSWY3DPEHPK3PXP")
+	if err == nil {
+		t.Errorf("Expected a raw TOTP secret to be rejected")
+	}
+
+	var opts TargetConfigOptions
+	err = json.Unmarshal([]byte(`{"Jump Hosts": [{"Host": "bastion", "Password": "hunter2"}]}`), &opts)
+	if err == nil {
+		t.Errorf("Expected a raw password in the expanded form to be rejected")
+	}
+
+	jumpHosts, err := ParseJumpHosts("admin@bastion?password=env:BASTION_PASSWORD&totp=file:/secrets/totp")
+	if err != nil {
+		t.Fatalf("Expected secret references to be accepted, got %s", err)
+	}
+	if *jumpHosts[0].Password != "env:BASTION_PASSWORD" || *jumpHosts[0].TotpSecret != "file:/secrets/totp" {
+		t.Errorf("Unexpected secrets: %+v", jumpHosts[0])
+	}
+
+	out, err := json.Marshal(jumpHosts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "password=env%3ABASTION_PASSWORD") {
+		t.Errorf("Expected the reference to be stored, got %s", out)
+	}
+}
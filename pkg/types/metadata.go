@@ -2,4 +2,6 @@ package types
 
 type TargetMetadata struct {
 	NetworkId string
+	// SockPath is the docker socket used on the host of the daemon, empty if it's not reached through a socket
+	SockPath string
 }
@@ -0,0 +1,113 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// CurrentSchemaVersion is the version of the target options shape of this provider. The Schema Version isn't part
+// of the manifest, so users can't change it, and the daytona CLI only writes the options of the manifest. Options
+// without a Schema Version are therefore version 0: they were written before options were versioned or by the CLI.
+// Migrations have to leave options that are already in the shape of their target version unchanged.
+const CurrentSchemaVersion = 1
+
+const schemaVersionKey = "Schema Version"
+
+// ErrSchemaVersionUnsupported is returned for target options written by a newer version of the provider
+var ErrSchemaVersionUnsupported = errors.New("unsupported target options schema version")
+
+// migration upgrades target options from one schema version to the next
+type migration func(options map[string]interface{})
+
+// migrations[i] upgrades options of version i to version i+1. Relabeling or restructuring an option requires
+// bumping CurrentSchemaVersion, appending a migration and adding a fixture of the previous format to testdata.
+var migrations = []migration{
+	migrateV0ToV1,
+}
+
+// MigrateTargetConfigOptions upgrades target options JSON of any schema version to the current one. Keys that aren't
+// target options are kept and returned as warnings.
+func MigrateTargetConfigOptions(optionsJson string) (string, []string, error) {
+	var options map[string]interface{}
+	err := json.Unmarshal([]byte(optionsJson), &options)
+	if err != nil {
+		return "", nil, err
+	}
+	if options == nil {
+		options = map[string]interface{}{}
+	}
+
+	version, err := schemaVersion(options)
+	if err != nil {
+		return "", nil, err
+	}
+	if version > CurrentSchemaVersion {
+		return "", nil, fmt.Errorf("%w: the target options have %s %d but this provider only supports up to %d, update the docker provider", ErrSchemaVersionUnsupported, schemaVersionKey, version, CurrentSchemaVersion)
+	}
+
+	for ; version < CurrentSchemaVersion; version++ {
+		migrations[version](options)
+	}
+	// The options are stamped when they're parsed, the stored options are only updated by the presets
+	options[schemaVersionKey] = CurrentSchemaVersion
+
+	dropBlankOptions(options)
+
+	var warnings []string
+	knownKeys := optionKeys()
+	for key := range options {
+		if !knownKeys[key] {
+			warnings = append(warnings, fmt.Sprintf("unknown target option %q is ignored", key))
+		}
+	}
+	sort.Strings(warnings)
+
+	migrated, err := json.Marshal(options)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return string(migrated), warnings, nil
+}
+
+func schemaVersion(options map[string]interface{}) (int, error) {
+	value, ok := options[schemaVersionKey]
+	if !ok {
+		return 0, nil
+	}
+
+	// JSON numbers are decoded as float64
+	version, ok := value.(float64)
+	if !ok || version < 0 || version != float64(int(version)) {
+		return 0, fmt.Errorf("invalid %s %v", schemaVersionKey, value)
+	}
+
+	return int(version), nil
+}
+
+// optionKeys returns the keys of the current target options
+func optionKeys() map[string]bool {
+	keys := map[string]bool{}
+	optionsType := reflect.TypeOf(TargetConfigOptions{})
+	for i := 0; i < optionsType.NumField(); i++ {
+		keys[strings.Split(optionsType.Field(i).Tag.Get("json"), ",")[0]] = true
+	}
+	return keys
+}
+
+// migrateV0ToV1 keeps the option shape, version 1 only introduced the Schema Version
+func migrateV0ToV1(options map[string]interface{}) {}
+
+// dropBlankOptions removes empty strings, whatever the schema version. The daytona CLI writes them for the options
+// left blank, while unset options are omitted so that e.g. a blank Remote Hostname doesn't make a target remote.
+func dropBlankOptions(options map[string]interface{}) {
+	for key, value := range options {
+		if value == "" {
+			delete(options, key)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Every format target options were ever stored in, the file names start with the schema version
+var fixtures = map[string]bool{
+	"v0-baseline-local.json":  true,
+	"v0-baseline-remote.json": false,
+	"v0-cli.json":             false,
+	"v0-jump-hosts-list.json": false,
+	"v1-cli.json":             true,
+	"v1-tcp.json":             false,
+}
+
+func TestMigrateFixtures(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "target_options", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != len(fixtures) {
+		t.Errorf("Expected %d fixtures, found %d", len(fixtures), len(files))
+	}
+
+	for _, file := range files {
+		expectedIsLocal, ok := fixtures[filepath.Base(file)]
+		if !ok {
+			t.Errorf("Fixture %s is not listed", file)
+			continue
+		}
+
+		content, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, warnings, err := MigrateTargetConfigOptions(string(content))
+		if err != nil {
+			t.Errorf("Failed to migrate %s: %v", file, err)
+			continue
+		}
+		if len(warnings) > 0 {
+			t.Errorf("Unexpected warnings for %s: %v", file, warnings)
+		}
+
+		options, isLocal, err := ParseTargetConfigOptions(string(content))
+		if err != nil {
+			t.Errorf("Failed to parse %s: %v", file, err)
+			continue
+		}
+
+		if options.SchemaVersion == nil || *options.SchemaVersion != CurrentSchemaVersion {
+			t.Errorf("Expected %s to be migrated to version %d, got %v", file, CurrentSchemaVersion, options.SchemaVersion)
+		}
+		if isLocal != expectedIsLocal {
+			t.Errorf("Expected isLocal %v for %s, got %v", expectedIsLocal, file, isLocal)
+		}
+	}
+}
+
+func TestMigrateDropsEmptyOptions(t *testing.T) {
+	content, err := os.ReadFile(filepath.Join("testdata", "target_options", "v0-cli.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	options, _, err := ParseTargetConfigOptions(string(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if options.DockerHost != nil || options.RemotePassword != nil || options.SockPath != nil {
+		t.Errorf("Expected the empty options to be unset, got %+v", options)
+	}
+	if options.JumpHosts == nil || len(*options.JumpHosts) != 1 || *options.RemotePort != 2222 {
+		t.Errorf("Expected the other options to be kept, got %+v", options)
+	}
+
+	// The CLI writes the blank options of the current version too
+	content, err = os.ReadFile(filepath.Join("testdata", "target_options", "v1-cli.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	options, isLocal, err := ParseTargetConfigOptions(string(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isLocal || options.RemoteHostname != nil || options.JumpHosts != nil {
+		t.Errorf("Expected the blank remote options to be unset, got %+v", options)
+	}
+}
+
+func TestManifestHidesSchemaVersion(t *testing.T) {
+	if _, ok := (*GetTargetConfigManifest())[schemaVersionKey]; ok {
+		t.Errorf("Expected the %s not to be editable in the manifest", schemaVersionKey)
+	}
+}
+
+func TestMigrateNewerSchemaVersion(t *testing.T) {
+	_, _, err := ParseTargetConfigOptions(`{"Schema Version": 99, "Sock Path": "/var/run/docker.sock"}`)
+	if !errors.Is(err, ErrSchemaVersionUnsupported) {
+		t.Fatalf("Expected an unsupported schema version error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "99") || !strings.Contains(err.Error(), "update the docker provider") {
+		t.Errorf("Expected the error to name the version and how to fix it, got %v", err)
+	}
+
+	_, _, err = ParseTargetConfigOptions(fmt.Sprintf(`{"Schema Version": %d, "Sock Path": "/var/run/docker.sock"}`, CurrentSchemaVersion))
+	if err != nil {
+		t.Errorf("Expected the current schema version to be supported, got %v", err)
+	}
+}
+
+func TestMigrateWarnings(t *testing.T) {
+	_, warnings, err := MigrateTargetConfigOptions(`{"Remote Hostname": "docker.example.com", "Remote Pasword": "secret"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "Remote Pasword") {
+		t.Errorf("Expected a warning for the unknown option, got %v", warnings)
+	}
+}
@@ -0,0 +1,130 @@
+package types
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Prefixes of secret references. Secret options set to a reference hold where the secret is read from instead of
+// the secret, so the stored options never contain it.
+const (
+	SecretRefEnv  = "env:"
+	SecretRefFile = "file:"
+	SecretRefCmd  = "cmd:"
+	// SecretRefRaw escapes a literal value, e.g. a password starting with one of the other prefixes
+	SecretRefRaw = "raw:"
+)
+
+// AllowCommandsEnv is the environment variable of the provider host allowing target options to run commands on it,
+// with `cmd:` secret references and the Keyboard Interactive Command. Otherwise anyone who can edit target options
+// could run commands as the provider.
+const AllowCommandsEnv = "DAYTONA_DOCKER_PROVIDER_ALLOW_COMMANDS"
+
+var ErrCommandsNotAllowed = fmt.Errorf("commands from target options are not allowed, set %s=true on the provider host to allow them", AllowCommandsEnv)
+
+// secretCmdTimeout bounds `cmd:` references, e.g. a password manager waiting for an unlock
+const secretCmdTimeout = 30 * time.Second
+
+// secretOptions are the options that accept secret references
+var secretOptions = []string{
+	"Remote Password",
+	"Remote Private Key",
+	"Remote Private Key Passphrase",
+	"Keyboard Interactive Answers",
+	"TOTP Secret",
+}
+
+// ResolveSecret returns the secret a value refers to. `env:NAME` reads an environment variable, `file:/path` reads
+// a file and `cmd:command` runs a command with `sh -c` and uses its output, without the trailing newline, if
+// CommandsAllowed. `raw:value` is the literal value. Other values are returned as is. Nil is returned for nil.
+func ResolveSecret(value *string) (*string, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	var secret string
+	switch {
+	case strings.HasPrefix(*value, SecretRefRaw):
+		secret = strings.TrimPrefix(*value, SecretRefRaw)
+	case strings.HasPrefix(*value, SecretRefEnv):
+		name := strings.TrimPrefix(*value, SecretRefEnv)
+		env, ok := os.LookupEnv(name)
+		if !ok {
+			return nil, fmt.Errorf("secret environment variable %s is not set", name)
+		}
+		secret = env
+	case strings.HasPrefix(*value, SecretRefFile):
+		path := strings.TrimPrefix(*value, SecretRefFile)
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read secret file: %w", err)
+		}
+		secret = strings.TrimRight(string(content), "\r\n")
+	case strings.HasPrefix(*value, SecretRefCmd):
+		if !CommandsAllowed() {
+			return nil, fmt.Errorf("%s secret reference: %w", SecretRefCmd, ErrCommandsNotAllowed)
+		}
+		output, err := runSecretCommand(strings.TrimPrefix(*value, SecretRefCmd))
+		if err != nil {
+			return nil, err
+		}
+		secret = strings.TrimRight(output, "\r\n")
+	default:
+		return value, nil
+	}
+
+	return &secret, nil
+}
+
+func runSecretCommand(command string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), secretCmdTimeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		// The command is part of the options, its output may not be
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return "", fmt.Errorf("secret command %q timed out after %s", command, secretCmdTimeout)
+		}
+		return "", fmt.Errorf("secret command %q failed: %w: %s", command, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return string(output), nil
+}
+
+// CommandsAllowed reports whether AllowCommandsEnv is set to true on the provider host
+func CommandsAllowed() bool {
+	allowed, _ := strconv.ParseBool(os.Getenv(AllowCommandsEnv))
+	return allowed
+}
+
+// IsSecretReference checks if the value refers to a secret instead of holding it
+func IsSecretReference(value string) bool {
+	for _, prefix := range []string{SecretRefEnv, SecretRefFile, SecretRefCmd} {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateSecretReference returns a message if the value is a secret reference without a name, path or command
+func validateSecretReference(value string) string {
+	for _, prefix := range []string{SecretRefEnv, SecretRefFile, SecretRefCmd} {
+		if strings.HasPrefix(value, prefix) && strings.TrimSpace(strings.TrimPrefix(value, prefix)) == "" {
+			return fmt.Sprintf("the %s secret reference is empty", prefix)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,70 @@
+package types
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveSecret(t *testing.T) {
+	t.Setenv("DAYTONA_TEST_SECRET", "from-env")
+
+	secretFile := filepath.Join(t.TempDir(), "secret")
+	err := os.WriteFile(secretFile, []byte("from-file\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		value     string
+		expected  string
+		expectErr bool
+	}{
+		{value: "plain", expected: "plain"},
+		{value: "env:DAYTONA_TEST_SECRET", expected: "from-env"},
+		{value: "env:DAYTONA_TEST_MISSING", expectErr: true},
+		{value: "file:" + secretFile, expected: "from-file"},
+		{value: "file:" + secretFile + ".missing", expectErr: true},
+		{value: "cmd:echo from-cmd", expected: "from-cmd"},
+		{value: "cmd:exit 1", expectErr: true},
+		{value: "raw:env:DAYTONA_TEST_SECRET", expected: "env:DAYTONA_TEST_SECRET"},
+		{value: "raw:", expected: ""},
+	}
+
+	t.Setenv(AllowCommandsEnv, "true")
+	for _, test := range tests {
+		secret, err := ResolveSecret(&test.value)
+		if test.expectErr {
+			if err == nil {
+				t.Errorf("Expected an error for %s", test.value)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Unexpected error for %s: %v", test.value, err)
+			continue
+		}
+		if *secret != test.expected {
+			t.Errorf("Expected %s for %s, got %s", test.expected, test.value, *secret)
+		}
+	}
+
+	_, _, err = ParseTargetConfigOptions(`{"Remote Hostname": "docker.example.com", "Remote Password": "env:"}`)
+	if err == nil {
+		t.Errorf("Expected an error for an empty secret reference")
+	}
+}
+
+func TestResolveSecretCommandsNotAllowed(t *testing.T) {
+	for _, value := range []string{"", "false", "no"} {
+		t.Setenv(AllowCommandsEnv, value)
+
+		reference := "cmd:echo from-cmd"
+		_, err := ResolveSecret(&reference)
+		if !errors.Is(err, ErrCommandsNotAllowed) {
+			t.Errorf("Expected cmd: references to be refused with %s=%q, got %v", AllowCommandsEnv, value, err)
+		}
+	}
+}
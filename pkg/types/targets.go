@@ -2,66 +2,353 @@ package types
 
 import (
 	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
 
+	"github.com/daytonaio/daytona-provider-docker/pkg/docker_context"
+	"github.com/daytonaio/daytona-provider-docker/pkg/ssh_tunnel"
 	"github.com/daytonaio/daytona/pkg/models"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// RemoteConnectionModeSocketForward forwards the remote docker socket to a local socket file
+	RemoteConnectionModeSocketForward = "socket-forward"
+	// RemoteConnectionModeSshDirect dials the remote docker socket over SSH for every API connection
+	RemoteConnectionModeSshDirect = "ssh-direct"
+	// RemoteConnectionModeDialStdio runs `docker system dial-stdio` on the remote host for every API connection
+	RemoteConnectionModeDialStdio = "dial-stdio"
 )
 
+const (
+	// AuthMethodAuto picks one authentication from the options that are set, without falling back to the others: the
+	// password, then the private key content, then the private key with its certificate, then the certificate, then
+	// keyboard-interactive. The default keys and the ssh-agent are only used when none of them is set
+	AuthMethodAuto = "auto"
+	// AuthMethodPassword only uses the Remote Password
+	AuthMethodPassword = "password"
+	// AuthMethodKeyFile only uses the Remote Private Key Path
+	AuthMethodKeyFile = "key-file"
+	// AuthMethodInlineKey only uses the Remote Private Key content
+	AuthMethodInlineKey = "inline-key"
+	// AuthMethodAgent only uses the keys of the ssh-agent, restricted to the SSH Agent Identities if they are set
+	AuthMethodAgent = "agent"
+	// AuthMethodCertificate only uses the Remote Certificate Path, with the Remote Private Key Path or the ssh-agent
+	AuthMethodCertificate = "certificate"
+)
+
+// LocalPresetsPredicate disables the options of remote hosts for the presets of local sockets
+const LocalPresetsPredicate = "^(local|podman|podman-rootless)$"
+
 type TargetConfigOptions struct {
-	RemoteHostname   *string `json:"Remote Hostname,omitempty"`
-	RemotePort       *int    `json:"Remote Port,omitempty"`
-	RemoteUser       *string `json:"Remote User,omitempty"`
-	RemotePassword   *string `json:"Remote Password,omitempty"`
-	RemotePrivateKey *string `json:"Remote Private Key Path,omitempty"`
-	SockPath         *string `json:"Sock Path,omitempty"`
-	TargetDataDir    *string `json:"Target Data Dir,omitempty"`
+	SchemaVersion        *int       `json:"Schema Version,omitempty"`
+	RemoteHostname       *string    `json:"Remote Hostname,omitempty"`
+	RemotePort           *int       `json:"Remote Port,omitempty"`
+	RemoteUser           *string    `json:"Remote User,omitempty"`
+	AuthMethod           *string    `json:"Auth Method,omitempty"`
+	RemotePassword       *string    `json:"Remote Password,omitempty"`
+	RemotePrivateKey     *string    `json:"Remote Private Key Path,omitempty"`
+	RemotePrivateKeyData *string    `json:"Remote Private Key,omitempty"`
+	RemotePassphrase     *string    `json:"Remote Private Key Passphrase,omitempty"`
+	RemotePassphraseFile *string    `json:"Remote Private Key Passphrase File,omitempty"`
+	RemoteCertificate    *string    `json:"Remote Certificate Path,omitempty"`
+	AgentSocket          *string    `json:"SSH Agent Socket,omitempty"`
+	AgentIdentities      *string    `json:"SSH Agent Identities,omitempty"`
+	KbdAnswers           *string    `json:"Keyboard Interactive Answers,omitempty"`
+	KbdCommand           *string    `json:"Keyboard Interactive Command,omitempty"`
+	TotpSecret           *string    `json:"TOTP Secret,omitempty"`
+	HostKeyPolicy        *string    `json:"Host Key Policy,omitempty"`
+	JumpHosts            *JumpHosts `json:"Jump Hosts,omitempty"`
+	ExposeServerApi      *bool      `json:"Expose Server API,omitempty"`
+	SockPath             *string    `json:"Sock Path,omitempty"`
+	RemoteConnectionMode *string    `json:"Remote Connection Mode,omitempty"`
+	DockerHost           *string    `json:"Docker Host URL,omitempty"`
+	TlsCaCert            *string    `json:"TLS CA Cert Path,omitempty"`
+	TlsCert              *string    `json:"TLS Cert Path,omitempty"`
+	TlsKey               *string    `json:"TLS Key Path,omitempty"`
+	DockerContext        *string    `json:"Docker Context,omitempty"`
+	TargetDataDir        *string    `json:"Target Data Dir,omitempty"`
 }
 
 func GetTargetConfigManifest() *models.TargetConfigManifest {
 	return &models.TargetConfigManifest{
 		"Remote Hostname": models.TargetConfigProperty{
 			Type:              models.TargetConfigPropertyTypeString,
-			DisabledPredicate: "^local$",
+			Description:       "Hostname or a Host alias from ~/.ssh/config. Options set here override the ssh config",
+			DisabledPredicate: LocalPresetsPredicate,
 		},
 		"Remote Port": models.TargetConfigProperty{
 			Type:              models.TargetConfigPropertyTypeInt,
-			DefaultValue:      "22",
-			DisabledPredicate: "^local$",
+			Description:       "Defaults to the Port of the ssh config, then to 22",
+			DisabledPredicate: LocalPresetsPredicate,
 		},
 		"Remote User": models.TargetConfigProperty{
 			Type: models.TargetConfigPropertyTypeString,
 			// TODO: Add docs entry
 			Description:       "Note: non-root user required",
-			DisabledPredicate: "^local$",
+			DisabledPredicate: LocalPresetsPredicate,
+		},
+		"Auth Method": models.TargetConfigProperty{
+			Type:         models.TargetConfigPropertyTypeOption,
+			DefaultValue: AuthMethodAuto,
+			Options: []string{
+				AuthMethodAuto,
+				AuthMethodPassword,
+				AuthMethodKeyFile,
+				AuthMethodInlineKey,
+				AuthMethodAgent,
+				AuthMethodCertificate,
+			},
+			Description:       "How to authenticate to the remote host. password uses the Remote Password, key-file the Remote Private Key Path, inline-key the Remote Private Key, agent the keys of the SSH Agent Socket and certificate the Remote Certificate Path. auto picks one method from the options that are set and never falls back to another: the Remote Password, else the Remote Private Key, else the Remote Private Key Path with its certificate, else the Remote Certificate Path, else keyboard-interactive. With none of them set, auto uses the default keys and the ssh-agent. Auth Method doesn't hide or show the other options, the options of the methods that aren't used are ignored",
+			DisabledPredicate: LocalPresetsPredicate,
 		},
 		"Remote Password": models.TargetConfigProperty{
 			Type:              models.TargetConfigPropertyTypeString,
-			DisabledPredicate: "^local$",
+			Description:       "Also accepts env:NAME, file:/path and cmd:command references, resolved when connecting. Prefix a literal password starting with one of them with raw:",
+			DisabledPredicate: LocalPresetsPredicate,
 			InputMasked:       true,
 		},
 		"Remote Private Key Path": models.TargetConfigProperty{
 			Type:              models.TargetConfigPropertyTypeFilePath,
-			DefaultValue:      "~/.ssh",
-			DisabledPredicate: "^local$",
+			Description:       "Defaults to the IdentityFile of the ssh config, then to the default keys and the ssh-agent",
+			DisabledPredicate: LocalPresetsPredicate,
+		},
+		"Remote Private Key": models.TargetConfigProperty{
+			Type:              models.TargetConfigPropertyTypeString,
+			Description:       "PEM content of the private key, for runners that don't have the key file. Newlines may be written as \\n and the content may be base64 encoded. Also accepts env:NAME, file:/path and cmd:command references. Takes precedence over the Remote Private Key Path",
+			DisabledPredicate: LocalPresetsPredicate,
+			InputMasked:       true,
+		},
+		"Remote Private Key Passphrase": models.TargetConfigProperty{
+			Type:              models.TargetConfigPropertyTypeString,
+			Description:       "Passphrase of an encrypted Remote Private Key or Remote Private Key Path, or an env:NAME, file:/path or cmd:command reference. Defaults to the DAYTONA_SSH_KEY_PASSPHRASE environment variable",
+			DisabledPredicate: LocalPresetsPredicate,
+			InputMasked:       true,
+		},
+		"Remote Private Key Passphrase File": models.TargetConfigProperty{
+			Type:              models.TargetConfigPropertyTypeFilePath,
+			Description:       "File containing the passphrase of an encrypted Remote Private Key Path",
+			DisabledPredicate: LocalPresetsPredicate,
+		},
+		"Remote Certificate Path": models.TargetConfigProperty{
+			Type:              models.TargetConfigPropertyTypeFilePath,
+			Description:       "OpenSSH user certificate signed for the private key. Defaults to the -cert.pub file next to the private key. Without a private key, the key is taken from the ssh-agent",
+			DisabledPredicate: LocalPresetsPredicate,
+		},
+		"SSH Agent Socket": models.TargetConfigProperty{
+			Type:              models.TargetConfigPropertyTypeFilePath,
+			Description:       "Socket of the ssh-agent holding the keys. Defaults to the IdentityAgent of the ssh config, then to the SSH_AUTH_SOCK environment variable of the provider, which is usually not set when the Daytona server starts it",
+			DisabledPredicate: LocalPresetsPredicate,
+		},
+		"SSH Agent Identities": models.TargetConfigProperty{
+			Type:              models.TargetConfigPropertyTypeString,
+			Description:       "Comma separated SHA256 fingerprints or comments of the ssh-agent keys to use, e.g. SHA256:abc... or user@laptop. Defaults to all the keys of the agent",
+			DisabledPredicate: LocalPresetsPredicate,
+		},
+		"Keyboard Interactive Answers": models.TargetConfigProperty{
+			Type:              models.TargetConfigPropertyTypeString,
+			Description:       "Comma separated answers to the keyboard-interactive prompts of the remote host, in order, or an env:NAME, file:/path or cmd:command reference to them",
+			DisabledPredicate: LocalPresetsPredicate,
+			InputMasked:       true,
+		},
+		"Keyboard Interactive Command": models.TargetConfigProperty{
+			Type:              models.TargetConfigPropertyTypeString,
+			Description:       "Command run for every keyboard-interactive prompt of the remote host. The prompt is passed in the DAYTONA_SSH_PROMPT environment variable and the command output is used as the answer, the command is killed after 30 seconds. Requires DAYTONA_DOCKER_PROVIDER_ALLOW_COMMANDS=true on the provider host",
+			DisabledPredicate: LocalPresetsPredicate,
+		},
+		"TOTP Secret": models.TargetConfigProperty{
+			Type:              models.TargetConfigPropertyTypeString,
+			Description:       "Base32 secret, or an env:NAME, file:/path or cmd:command reference to it, used to answer the one-time password prompts of the remote host. Password prompts are still answered with the Remote Password",
+			DisabledPredicate: LocalPresetsPredicate,
+			InputMasked:       true,
+		},
+		"Host Key Policy": models.TargetConfigProperty{
+			Type:         models.TargetConfigPropertyTypeOption,
+			DefaultValue: string(ssh_tunnel.HostKeyPolicyTrustOnFirstUse),
+			Options: []string{
+				string(ssh_tunnel.HostKeyPolicyStrict),
+				string(ssh_tunnel.HostKeyPolicyTrustOnFirstUse),
+				string(ssh_tunnel.HostKeyPolicyInsecure),
+			},
+			Description:       "How the remote host key is verified against ~/.ssh/known_hosts and the provider's known hosts file. trust-on-first-use, the default, records the key of a host that isn't known yet without verifying it, so the first connection is not verified. Use strict with the key in ~/.ssh/known_hosts to verify every connection",
+			DisabledPredicate: LocalPresetsPredicate,
+		},
+		"Jump Hosts": models.TargetConfigProperty{
+			Type:              models.TargetConfigPropertyTypeString,
+			Description:       "Comma separated chain of user@host:port bastions to connect through. Use ?key=<path>, ?password=<ref>, ?totp=<ref> or ?kbd-command=<command> to set the authentication of a jump host, the password and TOTP secret must be env:NAME, file:/path or cmd:command references",
+			DisabledPredicate: LocalPresetsPredicate,
+		},
+		"Expose Server API": models.TargetConfigProperty{
+			Type:              models.TargetConfigPropertyTypeBoolean,
+			DefaultValue:      "false",
+			Description:       "Expose the Daytona server API to the workspaces on the remote host through a reverse SSH tunnel listening on the bridge gateway. Requires GatewayPorts clientspecified in the remote sshd config",
+			DisabledPredicate: LocalPresetsPredicate,
 		},
 		"Sock Path": models.TargetConfigProperty{
-			Type:         models.TargetConfigPropertyTypeString,
-			DefaultValue: "/var/run/docker.sock",
+			Type:        models.TargetConfigPropertyTypeString,
+			Description: "Docker API socket on the local or remote host. Defaults to the first socket that answers among $DOCKER_HOST, $XDG_RUNTIME_DIR/docker.sock, /run/user/<uid>/docker.sock, /var/run/docker.sock and the Podman sockets",
+		},
+		"Remote Connection Mode": models.TargetConfigProperty{
+			Type:         models.TargetConfigPropertyTypeOption,
+			DefaultValue: RemoteConnectionModeSocketForward,
+			Options: []string{
+				RemoteConnectionModeSocketForward,
+				RemoteConnectionModeSshDirect,
+				RemoteConnectionModeDialStdio,
+			},
+			Description:       "How the remote docker socket is reached. socket-forward forwards it to a local socket file, ssh-direct dials it over SSH for every connection without a local socket and dial-stdio runs `docker system dial-stdio` on the remote host, for users that can run the docker CLI but can't open the socket",
+			DisabledPredicate: LocalPresetsPredicate,
+		},
+		"Docker Host URL": models.TargetConfigProperty{
+			Type:              models.TargetConfigPropertyTypeString,
+			Description:       "tcp:// URL of a docker daemon reached without SSH, e.g. tcp://docker.example.com:2376. Can't be combined with the Remote Hostname",
+			DisabledPredicate: LocalPresetsPredicate,
+		},
+		"TLS CA Cert Path": models.TargetConfigProperty{
+			Type:              models.TargetConfigPropertyTypeFilePath,
+			Description:       "CA certificate used to verify the daemon of the Docker Host URL. Defaults to the system CAs",
+			DisabledPredicate: LocalPresetsPredicate,
+		},
+		"TLS Cert Path": models.TargetConfigProperty{
+			Type:              models.TargetConfigPropertyTypeFilePath,
+			Description:       "Client certificate presented to the daemon of the Docker Host URL. Requires the TLS Key Path",
+			DisabledPredicate: LocalPresetsPredicate,
+		},
+		"TLS Key Path": models.TargetConfigProperty{
+			Type:              models.TargetConfigPropertyTypeFilePath,
+			Description:       "Private key of the TLS Cert Path",
+			DisabledPredicate: LocalPresetsPredicate,
+		},
+		"Docker Context": models.TargetConfigProperty{
+			Type:              models.TargetConfigPropertyTypeString,
+			Description:       "Name of a `docker context` whose endpoint and TLS material are used. Options set here override the context",
+			DisabledPredicate: LocalPresetsPredicate,
 		},
 		"Target Data Dir": models.TargetConfigProperty{
 			Type:              models.TargetConfigPropertyTypeString,
 			DefaultValue:      "/tmp/daytona-data",
-			Description:       "The directory on the remote host where the target data will be stored",
-			DisabledPredicate: "^local$",
+			Description:       "The directory on the remote host or the host of the Docker Host URL where the target data will be stored",
+			DisabledPredicate: LocalPresetsPredicate,
 		},
 	}
 }
 
+// ParseTargetConfigOptions parses the options of a target, migrates them to the current schema version, resolves its Docker Context, applies the manifest
+// defaults and validates the result. isLocal is set if the docker daemon runs on the host of the provider.
 func ParseTargetConfigOptions(optionsJson string) (opts *TargetConfigOptions, isLocal bool, err error) {
+	optionsJson, warnings, err := MigrateTargetConfigOptions(optionsJson)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, warning := range warnings {
+		log.Warn(warning)
+	}
+
 	var targetOptions TargetConfigOptions
 	err = json.Unmarshal([]byte(optionsJson), &targetOptions)
 	if err != nil {
 		return nil, false, err
 	}
 
-	return &targetOptions, targetOptions.RemoteHostname == nil, nil
+	err = targetOptions.ResolveDockerContext()
+	if err != nil {
+		return nil, false, err
+	}
+
+	targetOptions = targetOptions.WithDefaults()
+
+	err = targetOptions.Validate()
+	if err != nil {
+		return nil, false, err
+	}
+
+	return &targetOptions, targetOptions.isLocal(), nil
+}
+
+// ResolveDockerContext sets the host and TLS options of the target from its Docker Context. Options that are
+// already set are kept, so it can be called more than once.
+func (o *TargetConfigOptions) ResolveDockerContext() error {
+	if o.DockerContext == nil || *o.DockerContext == "" {
+		return nil
+	}
+
+	dockerContext, err := docker_context.Get(*o.DockerContext)
+	if err != nil {
+		return err
+	}
+
+	if dockerContext.Host == "" {
+		return nil
+	}
+
+	parsed, err := url.Parse(dockerContext.Host)
+	if err != nil {
+		return fmt.Errorf("invalid host %s in docker context %s: %w", dockerContext.Host, dockerContext.Name, err)
+	}
+
+	switch parsed.Scheme {
+	case "unix", "npipe":
+		setDefault(&o.SockPath, strings.TrimPrefix(dockerContext.Host, parsed.Scheme+"://"))
+	case "tcp":
+		if dockerContext.SkipTLSVerify {
+			return fmt.Errorf("docker context %s skips TLS verification, which is not supported", dockerContext.Name)
+		}
+		if o.RemoteHostname != nil {
+			return nil
+		}
+		setDefault(&o.DockerHost, dockerContext.Host)
+		setDefault(&o.TlsCaCert, dockerContext.TlsCaCert)
+		setDefault(&o.TlsCert, dockerContext.TlsCert)
+		setDefault(&o.TlsKey, dockerContext.TlsKey)
+	case "ssh":
+		if o.IsTcp() {
+			return nil
+		}
+		setDefault(&o.RemoteHostname, parsed.Hostname())
+		if parsed.User != nil {
+			setDefault(&o.RemoteUser, parsed.User.Username())
+		}
+		if parsed.Port() != "" && o.RemotePort == nil {
+			port, err := strconv.Atoi(parsed.Port())
+			if err != nil {
+				return fmt.Errorf("invalid port in docker context %s: %w", dockerContext.Name, err)
+			}
+			o.RemotePort = &port
+		}
+		// Like the docker CLI, reach the daemon with the docker CLI of the remote host
+		setDefault(&o.RemoteConnectionMode, RemoteConnectionModeDialStdio)
+	default:
+		return fmt.Errorf("unsupported host %s in docker context %s", dockerContext.Host, dockerContext.Name)
+	}
+
+	return nil
+}
+
+func setDefault(option **string, value string) {
+	if *option == nil && value != "" {
+		*option = &value
+	}
+}
+
+// isLocal reports whether the docker daemon of the target runs on the host of the provider
+func (o *TargetConfigOptions) isLocal() bool {
+	return o.RemoteHostname == nil && !o.IsTcp()
+}
+
+// IsTcp reports whether the docker daemon of the target is reached at the Docker Host URL instead of over SSH
+func (o *TargetConfigOptions) IsTcp() bool {
+	return o.DockerHost != nil && *o.DockerHost != ""
+}
+
+// UsesTls reports whether TLS material is set for the Docker Host URL
+func (o *TargetConfigOptions) UsesTls() bool {
+	for _, path := range []*string{o.TlsCaCert, o.TlsCert, o.TlsKey} {
+		if path != nil && *path != "" {
+			return true
+		}
+	}
+	return false
 }
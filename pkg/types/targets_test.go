@@ -0,0 +1,114 @@
+package types
+
+import (
+	"testing"
+)
+
+func TestParseTargetConfigOptionsDockerHost(t *testing.T) {
+	tests := []struct {
+		options   string
+		isLocal   bool
+		expectErr bool
+	}{
+		{options: `{"Sock Path": "/var/run/docker.sock"}`, isLocal: true},
+		{options: `{"Remote Hostname": "docker.example.com"}`},
+		{options: `{"Docker Host URL": "tcp://docker.example.com:2376"}`},
+		{options: `{"Docker Host URL": "tcp://docker.example.com:2376", "TLS Cert Path": "cert.pem", "TLS Key Path": "key.pem"}`},
+		{options: `{"Docker Host URL": "tcp://docker.example.com:2376", "TLS Cert Path": "cert.pem"}`, expectErr: true},
+		{options: `{"Docker Host URL": "tcp://docker.example.com:2376", "Remote Hostname": "docker.example.com"}`, expectErr: true},
+		{options: `{"Docker Host URL": "https://docker.example.com:2376"}`, expectErr: true},
+		{options: `{"TLS CA Cert Path": "ca.pem"}`, expectErr: true},
+	}
+
+	for _, test := range tests {
+		_, isLocal, err := ParseTargetConfigOptions(test.options)
+		if test.expectErr {
+			if err == nil {
+				t.Errorf("Expected an error for %s", test.options)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Unexpected error for %s: %v", test.options, err)
+		}
+		if isLocal != test.isLocal {
+			t.Errorf("Expected isLocal %v for %s, got %v", test.isLocal, test.options, isLocal)
+		}
+	}
+}
+
+func TestWithDefaults(t *testing.T) {
+	local, _, err := ParseTargetConfigOptions(`{}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if local.TargetDataDir != nil || local.HostKeyPolicy != nil {
+		t.Errorf("Expected no remote defaults for a local target, got %+v", local)
+	}
+
+	remote, _, err := ParseTargetConfigOptions(`{"Remote Hostname": "docker.example.com"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if remote.TargetDataDir == nil || *remote.TargetDataDir != "/tmp/daytona-data" {
+		t.Errorf("Expected the default Target Data Dir, got %v", remote.TargetDataDir)
+	}
+	if remote.ExposeServerApi == nil || *remote.ExposeServerApi {
+		t.Errorf("Expected Expose Server API to default to false, got %v", remote.ExposeServerApi)
+	}
+	if remote.RemotePort != nil {
+		t.Errorf("Expected the Remote Port to be left to the ssh config, got %d", *remote.RemotePort)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	_, _, err := ParseTargetConfigOptions(`{"Remote Hostname": "docker.example.com", "Remote Port": 70000, "Target Data Dir": "data", "Remote Connection Mode": "carrier-pigeon"}`)
+
+	validationErr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("Expected a validation error, got %v", err)
+	}
+
+	var fields []string
+	for _, fieldErr := range validationErr.Errors {
+		fields = append(fields, fieldErr.Field)
+	}
+
+	expected := []string{"Remote Connection Mode", "Remote Port", "Target Data Dir"}
+	if len(fields) != len(expected) {
+		t.Fatalf("Expected errors for %v, got %v", expected, fields)
+	}
+	for i := range expected {
+		if fields[i] != expected[i] {
+			t.Errorf("Expected errors for %v, got %v", expected, fields)
+		}
+	}
+}
+
+func TestAuthMethod(t *testing.T) {
+	options, _, err := ParseTargetConfigOptions(`{"Remote Hostname": "docker.example.com"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if options.AuthMethod == nil || *options.AuthMethod != AuthMethodAuto {
+		t.Errorf("Expected the auth method to default to %s, got %v", AuthMethodAuto, options.AuthMethod)
+	}
+
+	_, _, err = ParseTargetConfigOptions(`{"Remote Hostname": "docker.example.com", "Auth Method": "password"}`)
+	if err == nil {
+		t.Errorf("Expected an error for the password auth method without a Remote Password")
+	}
+
+	_, _, err = ParseTargetConfigOptions(`{"Remote Hostname": "docker.example.com", "Auth Method": "inline-key"}`)
+	if err == nil {
+		t.Errorf("Expected an error for the inline-key auth method without a Remote Private Key")
+	}
+
+	_, _, err = ParseTargetConfigOptions(`{"Remote Hostname": "docker.example.com", "Auth Method": "kerberos"}`)
+	if err == nil {
+		t.Errorf("Expected an error for an unknown auth method")
+	}
+}
@@ -0,0 +1,213 @@
+package types
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/daytonaio/daytona/pkg/models"
+)
+
+// FieldError is a missing or invalid target option
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// ValidationError holds the field errors of the target options
+type ValidationError struct {
+	Errors []*FieldError
+}
+
+func (e *ValidationError) Error() string {
+	var messages []string
+	for _, fieldErr := range e.Errors {
+		messages = append(messages, fieldErr.Error())
+	}
+	return "invalid target options: " + strings.Join(messages, "; ")
+}
+
+// WithDefaults returns the options with the manifest defaults applied to the options that aren't set. The defaults
+// of options disabled for the local presets are only applied to targets that aren't local.
+func (o TargetConfigOptions) WithDefaults() TargetConfigOptions {
+	isLocal := o.isLocal()
+
+	for name, property := range *GetTargetConfigManifest() {
+		if property.DefaultValue == "" {
+			continue
+		}
+		if isLocal && property.DisabledPredicate != "" {
+			continue
+		}
+
+		field, ok := optionField(&o, name)
+		if !ok || !field.IsNil() {
+			continue
+		}
+
+		value, err := parseDefaultValue(property)
+		if err != nil {
+			// The manifest is static, an invalid default is a bug
+			panic(fmt.Sprintf("invalid default value of %s: %v", name, err))
+		}
+
+		ptr := reflect.New(field.Type().Elem())
+		ptr.Elem().Set(reflect.ValueOf(value))
+		field.Set(ptr)
+	}
+
+	return o
+}
+
+// Validate checks the options against the manifest and returns a *ValidationError listing every invalid option
+func (o TargetConfigOptions) Validate() error {
+	var fieldErrors []*FieldError
+	addError := func(field, format string, args ...interface{}) {
+		fieldErrors = append(fieldErrors, &FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	for name, property := range *GetTargetConfigManifest() {
+		if property.Type != models.TargetConfigPropertyTypeOption {
+			continue
+		}
+
+		field, ok := optionField(&o, name)
+		if !ok || field.IsNil() {
+			continue
+		}
+
+		value := field.Elem().String()
+		if value != "" && !contains(property.Options, value) {
+			addError(name, "must be one of %s, got %q", strings.Join(property.Options, ", "), value)
+		}
+	}
+
+	for _, name := range secretOptions {
+		field, ok := optionField(&o, name)
+		if !ok || field.IsNil() {
+			continue
+		}
+
+		if message := validateSecretReference(field.Elem().String()); message != "" {
+			addError(name, message)
+		}
+	}
+
+	if o.JumpHosts != nil {
+		for _, jumpHost := range *o.JumpHosts {
+			for _, secret := range []*string{jumpHost.Password, jumpHost.TotpSecret} {
+				if secret == nil {
+					continue
+				}
+				if message := validateSecretReference(*secret); message != "" {
+					addError("Jump Hosts", "%s: %s", jumpHost.Host, message)
+				}
+			}
+		}
+	}
+
+	if o.RemoteHostname != nil && strings.TrimSpace(*o.RemoteHostname) == "" {
+		addError("Remote Hostname", "must not be empty")
+	}
+
+	if o.AuthMethod != nil && *o.AuthMethod == AuthMethodPassword && (o.RemotePassword == nil || *o.RemotePassword == "") {
+		addError("Remote Password", "is required with the %s Auth Method", AuthMethodPassword)
+	}
+
+	if o.AuthMethod != nil && *o.AuthMethod == AuthMethodInlineKey && (o.RemotePrivateKeyData == nil || *o.RemotePrivateKeyData == "") {
+		addError("Remote Private Key", "is required with the %s Auth Method", AuthMethodInlineKey)
+	}
+
+	if o.RemotePort != nil && (*o.RemotePort < 1 || *o.RemotePort > 65535) {
+		addError("Remote Port", "must be between 1 and 65535, got %d", *o.RemotePort)
+	}
+
+	if !o.isLocal() {
+		if o.TargetDataDir == nil || *o.TargetDataDir == "" {
+			addError("Target Data Dir", "is required for remote targets")
+		} else if !path.IsAbs(*o.TargetDataDir) {
+			addError("Target Data Dir", "must be an absolute path, got %q", *o.TargetDataDir)
+		}
+	}
+
+	if o.SockPath != nil && *o.SockPath != "" && !path.IsAbs(*o.SockPath) && !strings.HasPrefix(*o.SockPath, "//") {
+		addError("Sock Path", "must be an absolute path, got %q", *o.SockPath)
+	}
+
+	if o.AgentSocket != nil && *o.AgentSocket != "" && !path.IsAbs(*o.AgentSocket) {
+		addError("SSH Agent Socket", "must be an absolute path, got %q", *o.AgentSocket)
+	}
+
+	if o.IsTcp() {
+		if o.RemoteHostname != nil {
+			addError("Docker Host URL", "can't be combined with the Remote Hostname")
+		}
+
+		parsed, err := url.Parse(*o.DockerHost)
+		if err != nil || parsed.Scheme != "tcp" || parsed.Host == "" {
+			addError("Docker Host URL", "expected tcp://host:port, got %q", *o.DockerHost)
+		}
+
+		hasCert := o.TlsCert != nil && *o.TlsCert != ""
+		hasKey := o.TlsKey != nil && *o.TlsKey != ""
+		if hasCert && !hasKey {
+			addError("TLS Key Path", "is required with the TLS Cert Path")
+		}
+		if hasKey && !hasCert {
+			addError("TLS Cert Path", "is required with the TLS Key Path")
+		}
+	} else if o.UsesTls() {
+		addError("Docker Host URL", "is required with the TLS options")
+	}
+
+	if len(fieldErrors) == 0 {
+		return nil
+	}
+
+	// The manifest is a map, keep the errors in a stable order
+	sort.SliceStable(fieldErrors, func(i, j int) bool {
+		return fieldErrors[i].Field < fieldErrors[j].Field
+	})
+
+	return &ValidationError{Errors: fieldErrors}
+}
+
+// optionField returns the pointer field of the options tagged with the manifest property name
+func optionField(o *TargetConfigOptions, name string) (reflect.Value, bool) {
+	value := reflect.ValueOf(o).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		tag := strings.Split(value.Type().Field(i).Tag.Get("json"), ",")[0]
+		if tag == name && value.Field(i).Kind() == reflect.Ptr {
+			return value.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+func parseDefaultValue(property models.TargetConfigProperty) (interface{}, error) {
+	switch property.Type {
+	case models.TargetConfigPropertyTypeInt:
+		return strconv.Atoi(property.DefaultValue)
+	case models.TargetConfigPropertyTypeBoolean:
+		return strconv.ParseBool(property.DefaultValue)
+	default:
+		return property.DefaultValue, nil
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}